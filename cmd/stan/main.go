@@ -0,0 +1,62 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+// Command stan runs static checks on Go packages:
+//
+//	stan [-checks names] [-format text|json|sarif|junit|checkstyle] [-fix] [packages]
+//
+// It comes with the checks below. To run your own checks, build a command
+// calling stan.Main() with them instead.
+package main
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/retailnext/stan"
+)
+
+var timeEqual = &stan.Check{
+	Name: "timeequal",
+	Doc:  "don't compare time.Time values with == or !=\n\nThe monotonic clock reading and location take part in ==, use Equal() instead.",
+	Func: func(pkg *stan.Package, r stan.Reporter) {
+		for _, f := range pkg.Files() {
+			ast.Inspect(f, func(n ast.Node) bool {
+				binary, _ := n.(*ast.BinaryExpr)
+				if binary == nil || (binary.Op != token.EQL && binary.Op != token.NEQ) {
+					return true
+				}
+
+				if typ := pkg.TypeOf(binary.X); typ == nil || typ.String() != "time.Time" {
+					return true
+				}
+
+				recv := pkg.NodeString(binary.X)
+				switch binary.X.(type) {
+				case *ast.StarExpr, *ast.UnaryExpr, *ast.BinaryExpr:
+					recv = "(" + recv + ")"
+				}
+
+				fixed := recv + ".Equal(" + pkg.NodeString(binary.Y) + ")"
+				if binary.Op == token.NEQ {
+					fixed = "!" + fixed
+				}
+
+				r.Report(stan.Diagnostic{
+					Pos:     pkg.Pos(binary),
+					End:     pkg.Fset.Position(binary.End()),
+					Message: "use Equal() to compare time.Time values",
+					SuggestedFixes: []stan.SuggestedFix{{
+						Message:   "Use Equal()",
+						TextEdits: []stan.TextEdit{pkg.ReplaceNode(binary, fixed)},
+					}},
+				})
+				return true
+			})
+		}
+	},
+}
+
+func main() {
+	stan.Main(timeEqual)
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package generic
+
+type List[T any] struct {
+	items []T
+}
+
+func (l *List[T]) Push(v T) {
+	l.items = append(l.items, v)
+}
+
+type Map[K comparable, V any] map[K]V
+
+func Keys[K comparable, V any](m Map[K, V]) []K {
+	var ret []K
+	for k := range m {
+		ret = append(ret, k)
+	}
+	return ret
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package user
+
+import (
+	"bytes"
+
+	"github.com/retailnext/stan/internal/generic"
+)
+
+func use() {
+	var ints generic.List[int]
+	ints.Push(1)
+
+	strs := &generic.List[string]{}
+	strs.Push("a")
+	push := strs.Push
+	push("b")
+
+	m := generic.Map[string, *bytes.Buffer]{}
+	_ = generic.Keys(m)
+	_ = generic.Keys[int, int](nil)
+}
@@ -8,9 +8,12 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+
+	"golang.org/x/tools/go/ssa"
 )
 
 // Package contains combines the *ast.Package and *types.Package into a single
@@ -21,9 +24,20 @@ type Package struct {
 	TypesInfo *types.Info
 	TypesPkg  *types.Package
 
+	loader       *Loader
 	lifetimes    map[types.Object]ObjectLifetime
 	typesCache   map[string]types.Type
 	objectsCache map[string]types.Object
+	commentMaps  map[*ast.File]ast.CommentMap
+	buildFiles   []*ast.File
+
+	ssaOnce sync.Once
+	ssaPkg  *ssa.Package
+
+	// set when loaded with Loader.BuildConfigs
+	configs    []BuildConfig
+	variants   []*Package
+	objConfigs map[types.Object][]BuildConfig
 }
 
 type Poser interface {
@@ -50,6 +64,17 @@ func (p *Package) Files() map[string]*ast.File {
 	return p.Node.Files
 }
 
+// BuildFiles() returns the files of p that are buildable in its build
+// configuration (or any of its BuildConfigs), ordered by file name. Files()
+// also includes non-buildable files.
+func (p *Package) BuildFiles() []*ast.File {
+	ret := append([]*ast.File(nil), p.buildFiles...)
+	sort.Slice(ret, func(i, j int) bool {
+		return p.Fset.Position(ret[i].Pos()).Filename < p.Fset.Position(ret[j].Pos()).Filename
+	})
+	return ret
+}
+
 // ObjectOf() returns the corresponding types.Object of an ast.Node. n normally
 // should be an *ast.Ident, but ObjectOf will also extract the ident from an
 // *ast.SelectorExpr. The return value can be nil if there is no corresponding
@@ -86,21 +111,21 @@ func (p *Package) String() string {
 	return p.Path()
 }
 
-var (
-	packagesCache  = make(map[string][]*Package)
-	loadPackagesMu sync.Mutex
-)
-
 type importNode struct {
 	pkg        *parsedPackage
 	imports    map[string]*importNode
 	importedBy map[string]*importNode
 }
 
-// Pkgs() finds, parses and type checks the packages specified by pkgPaths.
+// Pkgs() finds, parses and type checks the packages specified by pkgPaths
+// using the default Loader.
 // Wildcard "..." expressions may be used, similar to various "go" commands.
+// Within a module, patterns resolve as they would for the go command in module
+// mode: local patterns yield packages named by their module import path, and
+// dependencies are found using the go.mod replace directives, vendor/ or the
+// module cache.
 // Pkgs() panics if there is a parse error, "hard" type check error, or if no
-// such package could be found.
+// such package could be found. Use LoadPkgs() to get an error instead.
 //
 // In order to maximize test coverage, Pkgs() does a few potentially unexpected
 // things to parse/check as much code as possible:
@@ -110,12 +135,39 @@ type importNode struct {
 //     available
 // 	 - loads all *.go files, even if non-buildable due to build constraints
 //     (stan will rename duplicate objects to prevent type checking errors,
-//     and ignore "hard" type check error for non-buildable files)
+//     and ignore "hard" type check error for non-buildable files; see
+//     Loader.BuildConfigs to check each platform separately instead)
 //
 func Pkgs(pkgPaths ...string) []*Package {
+	return defaultLoader.Pkgs(pkgPaths...)
+}
+
+// LoadPkgs() is like Pkgs(), but returns an error rather than panicking. The
+// packages that loaded successfully are returned even if others failed. A
+// non-nil error is always of type LoadErrors, listing a *PackageError for each
+// package that could not be found, parsed or type checked.
+func LoadPkgs(pkgPaths ...string) ([]*Package, error) {
+	return defaultLoader.LoadPkgs(pkgPaths...)
+}
+
+// Pkgs() is like the package level Pkgs(), but loads packages using l's
+// build configuration and caches.
+func (l *Loader) Pkgs(pkgPaths ...string) []*Package {
+	pkgs, err := l.LoadPkgs(pkgPaths...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return pkgs
+}
+
+// LoadPkgs() is like the package level LoadPkgs(), but loads packages using
+// l's build configuration and caches.
+func (l *Loader) LoadPkgs(pkgPaths ...string) ([]*Package, error) {
+	l.init()
+
 	// keep it simple
-	loadPackagesMu.Lock()
-	defer loadPackagesMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
 	var (
 		ret        []*Package
@@ -123,7 +175,7 @@ func Pkgs(pkgPaths ...string) []*Package {
 	)
 
 	for _, path := range pkgPaths {
-		if cached, found := packagesCache[path]; found {
+		if cached, found := l.packagesCache[path]; found {
 			ret = append(ret, cached...)
 		} else {
 			needLookup = append(needLookup, path)
@@ -131,16 +183,17 @@ func Pkgs(pkgPaths ...string) []*Package {
 	}
 
 	if len(needLookup) == 0 {
-		return ret
+		return ret, nil
 	}
 
 	var (
-		parsedPkgs = findAndParse(needLookup)
-		nodes      = make(map[string]*importNode)
+		parsedPkgs, parseErrs = l.findAndParse(needLookup)
+		nodes                 = make(map[string]*importNode)
+		checkErrs             = make(map[string]*PackageError)
 	)
 	for _, pkgs := range parsedPkgs {
 		for _, pkg := range pkgs {
-			if _, found := packagesCache[pkg.path]; found {
+			if _, found := l.packagesCache[pkg.path]; found {
 				continue
 			}
 			nodes[pkg.path] = &importNode{
@@ -166,52 +219,117 @@ func Pkgs(pkgPaths ...string) []*Package {
 		}
 	}
 
+	// type check a batch of packages concurrently, recording results once
+	// all are done
+	checkAll := func(batch []*importNode) {
+		var (
+			checked = make([]*Package, len(batch))
+			errs    = make([]*PackageError, len(batch))
+			sem     = make(chan struct{}, l.parallelism())
+			wg      sync.WaitGroup
+		)
+		for i, n := range batch {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, n *importNode) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				checked[i], errs[i] = l.typeCheck(n.pkg, nil)
+			}(i, n)
+		}
+		wg.Wait()
+
+		for i, n := range batch {
+			if errs[i] != nil {
+				checkErrs[n.pkg.path] = errs[i]
+				continue
+			}
+			l.packagesCache[n.pkg.path] = []*Package{checked[i]}
+			// stick our type checked *types.Package into the importer map to
+			// avoid extra work importing this package from other packages
+			checked[i].shareWithImporter()
+		}
+	}
+
 	// walk graph from leaf nodes so we know we have not encountered any importers
 	// of the current node yet
 	for len(nodes) > 0 {
-		startSize := len(nodes)
-		for id, n := range nodes {
+		var leaves []*importNode
+		for _, n := range nodes {
 			if len(n.imports) == 0 {
-				checked := typeCheck(n.pkg, nil)
-				packagesCache[n.pkg.path] = []*Package{checked}
-				// stick our type checked *types.Package into the importer map to
-				// avoid extra work importing this package from other packages
-				if imports[n.pkg.path] == nil {
-					imports[n.pkg.path] = checked.TypesPkg
-				}
-				for _, importsMe := range n.importedBy {
-					delete(importsMe.imports, n.pkg.path)
-				}
-				delete(nodes, id)
+				leaves = append(leaves, n)
 			}
 		}
 
-		if len(nodes) == startSize {
+		if len(leaves) == 0 {
 			// We probably have an import loop, but it is possible it isn't a loop due
 			// to vendoring. Type check remaining packages in un-optimized order.
 			for _, n := range nodes {
-				checked := typeCheck(n.pkg, nil)
-				packagesCache[n.pkg.path] = []*Package{checked}
+				checkAll([]*importNode{n})
 			}
 
 			break
 		}
+
+		checkAll(leaves)
+
+		for _, n := range leaves {
+			for _, importsMe := range n.importedBy {
+				delete(importsMe.imports, n.pkg.path)
+			}
+			delete(nodes, n.pkg.path)
+		}
 	}
 
+	var (
+		allErrs  LoadErrors
+		seenErrs = make(map[*PackageError]bool)
+	)
+
 	for i, pkgs := range parsedPkgs {
+		errs := parseErrs[i]
+
 		var loaded []*Package
 		for _, pkg := range pkgs {
-			loaded = append(loaded, packagesCache[pkg.path]...)
+			if err := checkErrs[pkg.path]; err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			loaded = append(loaded, l.packagesCache[pkg.path]...)
 		}
 		// sort packages so ordering is deterministic
 		sort.Slice(loaded, func(i, j int) bool {
 			return loaded[i].Path() < loaded[j].Path()
 		})
-		packagesCache[needLookup[i]] = loaded
+		if len(errs) == 0 {
+			// only remember complete results so errors are reported again
+			l.packagesCache[needLookup[i]] = loaded
+		}
 		ret = append(ret, loaded...)
+
+		// packages matched by multiple patterns share errors
+		for _, err := range errs {
+			if !seenErrs[err] {
+				seenErrs[err] = true
+				allErrs = append(allErrs, err)
+			}
+		}
 	}
 
-	return ret
+	if len(allErrs) > 0 {
+		return ret, allErrs
+	}
+
+	return ret, nil
+}
+
+func (l *Loader) parallelism() int {
+	if l.Parallelism > 0 {
+		return l.Parallelism
+	}
+	return runtime.GOMAXPROCS(0)
 }
 
 // ObjectLifetime represents the "lifetime" of an object.
@@ -226,9 +344,10 @@ type ObjectLifetime struct {
 
 // LifetimeOf() returns an object representing the lifetime of
 // types.Object obj within p. If obj is not used by p, LifetimeOf
-// returns the zero value ObjectLifetime.
+// returns the zero value ObjectLifetime. Uses of methods and fields of
+// instantiated generic types count as uses of the generic method or field.
 func (p *Package) LifetimeOf(obj types.Object) ObjectLifetime {
-	return p.lifetimes[obj]
+	return p.lifetimes[originOf(obj)]
 }
 
 // Look up ancestor nodes of given node. AncestorsOf panics if the target node
@@ -258,11 +377,37 @@ type Invocation struct {
 	Args []ast.Expr
 	// Invocation's *ast.CallExpr node
 	Call *ast.CallExpr
+	// Receiver expression of method invocations, e.g. w in w.Flush()
+	Recv ast.Expr
+	// Innermost *ast.FuncDecl or *ast.FuncLit containing Call, or nil for
+	// invocations in package level declarations
+	Func ast.Node
+	// Whether Call is deferred, or run in a new goroutine
+	IsDefer, IsGo bool
+	// Function or method value that Call invokes, e.g. w.Flush in
+	// "f := w.Flush; f()". Nil for direct invocations.
+	Value ast.Expr
+	// Interface method that Call invokes, for invocations dispatched
+	// through an interface (see InvocationsViaInterfaces). Nil otherwise.
+	Interface *types.Func
 }
 
-// InvocationsOf() returns the invocations of obj within p. InvocationsOf
-// panics if obj is not a *types.Func.
-func (p *Package) InvocationsOf(obj types.Object) []Invocation {
+// InvocationOption changes which invocations InvocationsOf() returns.
+type InvocationOption int
+
+const (
+	// InvocationsViaInterfaces includes calls of interface methods that
+	// may dispatch to the method, i.e. calls of a method of an interface
+	// implemented by the method's receiver type.
+	InvocationsViaInterfaces InvocationOption = iota + 1
+)
+
+// InvocationsOf() returns the invocations of obj within p, including
+// invocations of instantiations of generic functions and methods of generic
+// types. Functions and method values assigned to a local variable count as
+// invoked where the variable is called, unless the variable is reassigned.
+// InvocationsOf panics if obj is not a *types.Func.
+func (p *Package) InvocationsOf(obj types.Object, opts ...InvocationOption) []Invocation {
 	fn, _ := obj.(*types.Func)
 	if fn == nil {
 		panic(fmt.Sprintf("object %[1]s is not *types.Func (%[1]T)", obj))
@@ -272,29 +417,190 @@ func (p *Package) InvocationsOf(obj types.Object) []Invocation {
 	for _, use := range p.LifetimeOf(obj).Uses {
 		ancs := p.AncestorsOf(use)
 
-		var invocant types.Object
-		if sel, _ := ancs.Peek().(*ast.SelectorExpr); sel != nil {
-			switch x := sel.X.(type) {
-			case *ast.SelectorExpr:
-				invocant = p.ObjectOf(x.Sel)
-			case *ast.Ident:
-				invocant = p.ObjectOf(x)
+		call, sel := callOf(use, ancs)
+		if call == nil {
+			ret = append(ret, p.valueInvocations(use, sel, ancs)...)
+			continue
+		}
+
+		ret = append(ret, p.invocation(call, sel, ancestorsUpTo(ancs, call)))
+	}
+
+	for _, opt := range opts {
+		if opt == InvocationsViaInterfaces {
+			ret = append(ret, p.interfaceInvocations(fn)...)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Call.Pos() < ret[j].Call.Pos()
+	})
+
+	return ret
+}
+
+// invocation returns the Invocation of call, whose function is selected by
+// sel (if qualified) and whose ancestors are ancs.
+func (p *Package) invocation(call *ast.CallExpr, sel *ast.SelectorExpr, ancs Ancestors) Invocation {
+	inv := Invocation{
+		Args: call.Args,
+		Call: call,
+	}
+
+	if sel != nil {
+		switch x := sel.X.(type) {
+		case *ast.SelectorExpr:
+			inv.Invocant = p.ObjectOf(x.Sel)
+		case *ast.Ident:
+			inv.Invocant = p.ObjectOf(x)
+		}
+
+		if s := p.TypesInfo.Selections[sel]; s != nil && s.Kind() == types.MethodVal {
+			inv.Recv = sel.X
+		}
+	}
+
+	switch parent := ancs.Peek().(type) {
+	case *ast.DeferStmt:
+		inv.IsDefer = parent.Call == call
+	case *ast.GoStmt:
+		inv.IsGo = parent.Call == call
+	}
+
+	for i := len(ancs) - 1; i >= 0 && inv.Func == nil; i-- {
+		switch ancs[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			inv.Func = ancs[i]
+		}
+	}
+
+	return inv
+}
+
+// valueInvocations returns the invocations of the function or method value
+// use (qualified by sel), with ancestors ancs, through the local variable it
+// is assigned to, if any.
+func (p *Package) valueInvocations(use *ast.Ident, sel *ast.SelectorExpr, ancs Ancestors) []Invocation {
+	var value ast.Expr = use
+	if sel != nil {
+		value = sel
+		ancs.Pop()
+	}
+
+	var lhs ast.Expr
+	switch parent := ancs.Peek().(type) {
+	case *ast.AssignStmt:
+		for i, rhs := range parent.Rhs {
+			if rhs == value && len(parent.Lhs) == len(parent.Rhs) {
+				lhs = parent.Lhs[i]
+			}
+		}
+	case *ast.ValueSpec:
+		for i, v := range parent.Values {
+			if v == value && len(parent.Names) == len(parent.Values) {
+				lhs = parent.Names[i]
 			}
+		}
+	}
 
-			ancs.Pop()
+	id, _ := lhs.(*ast.Ident)
+	if id == nil {
+		return nil
+	}
+	v, _ := p.ObjectOf(id).(*types.Var)
+	if v == nil || v.Parent() == nil || v.Parent() == v.Pkg().Scope() {
+		// package level variables may be assigned anywhere
+		return nil
+	}
+
+	var ret []Invocation
+	for _, varUse := range p.LifetimeOf(v).Uses {
+		varAncs := p.AncestorsOf(varUse)
+
+		if assign, _ := varAncs.Peek().(*ast.AssignStmt); assign != nil {
+			for _, l := range assign.Lhs {
+				if l == varUse {
+					// reassigned, so we can't tell what it calls
+					return nil
+				}
+			}
 		}
 
-		call, _ := ancs.Peek().(*ast.CallExpr)
+		call, _ := callOf(varUse, varAncs)
 		if call == nil {
 			continue
 		}
 
-		ret = append(ret, Invocation{
-			Invocant: invocant,
-			Args:     call.Args,
-			Call:     call,
-		})
+		inv := p.invocation(call, sel, ancestorsUpTo(varAncs, call))
+		inv.Value = value
+		ret = append(ret, inv)
 	}
+	return ret
+}
+
+// interfaceInvocations returns the calls of interface methods in p that may
+// dispatch to method fn.
+func (p *Package) interfaceInvocations(fn *types.Func) []Invocation {
+	fn = fn.Origin()
+
+	sig := fn.Type().(*types.Signature)
+	if sig.Recv() == nil || isInterfaceMethod(fn) {
+		return nil
+	}
+
+	// both T and *T have the methods of T
+	recvTypes := []types.Type{sig.Recv().Type()}
+	if _, isPtr := sig.Recv().Type().(*types.Pointer); !isPtr {
+		recvTypes = append(recvTypes, types.NewPointer(sig.Recv().Type()))
+	}
+
+	dispatchesToFn := func(m *types.Func, iface *types.Interface) bool {
+		for _, t := range recvTypes {
+			if !types.Implements(t, iface) {
+				continue
+			}
+			obj, _, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+			if obj != nil && originOf(obj) == fn {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ret []Invocation
+	for sel, s := range p.TypesInfo.Selections {
+		if s.Kind() != types.MethodVal || s.Obj().Name() != fn.Name() {
+			continue
+		}
+		m, _ := s.Obj().(*types.Func)
+		if m == nil || !isInterfaceMethod(m) {
+			continue
+		}
+		iface, _ := s.Recv().Underlying().(*types.Interface)
+		if iface == nil || !dispatchesToFn(m, iface) {
+			continue
+		}
 
+		ancs := p.AncestorsOf(sel.Sel)
+		call, _ := callOf(sel.Sel, ancs)
+		if call == nil {
+			continue
+		}
+
+		inv := p.invocation(call, sel, ancestorsUpTo(ancs, call))
+		inv.Interface = m
+		ret = append(ret, inv)
+	}
 	return ret
 }
+
+// ancestorsUpTo returns the ancestors of n, given ancs, ancestors of a
+// descendant of n.
+func ancestorsUpTo(ancs Ancestors, n ast.Node) Ancestors {
+	for i := len(ancs) - 1; i >= 0; i-- {
+		if ancs[i] == n {
+			return ancs[:i]
+		}
+	}
+	return ancs
+}
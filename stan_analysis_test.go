@@ -119,6 +119,85 @@ func TestInvocationsOf(t *testing.T) {
 	}
 }
 
+func TestInvocationsOfDetails(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+import (
+	"bufio"
+	"os"
+)
+
+type flusher interface {
+	Flush() error
+}
+
+func direct(w *bufio.Writer) {
+	defer w.Flush()
+	go w.Flush()
+	w.Flush()
+}
+
+func values(w *bufio.Writer) {
+	f := w.Flush
+	func() {
+		f()
+	}()
+
+	var g = w.Flush
+	g = nil
+	g()
+}
+
+func dispatched(f flusher) {
+	f.Flush()
+}
+
+var flushed = bufio.NewWriter(os.Stdout).Flush()
+`)
+
+	flush := pkg.LookupObject("bufio.Writer.Flush")
+
+	invs := pkg.InvocationsOf(flush)
+	if len(invs) != 5 {
+		t.Fatalf("got %d", len(invs))
+	}
+
+	for i, inv := range invs[:3] {
+		if inv.Invocant.Name() != "w" || inv.Recv.(*ast.Ident).Name != "w" || inv.Func.(*ast.FuncDecl).Name.Name != "direct" || inv.Value != nil || inv.Interface != nil {
+			t.Errorf("%d: got %+v", i, inv)
+		}
+		if inv.IsDefer != (i == 0) || inv.IsGo != (i == 1) {
+			t.Errorf("%d: got %+v", i, inv)
+		}
+	}
+
+	// g is reassigned, so only f counts
+	if inv := invs[3]; inv.Invocant.Name() != "w" || pkg.Pos(inv.Call).Line != 22 || pkg.NodeString(inv.Value) != "w.Flush" {
+		t.Errorf("got %+v", inv)
+	}
+	if _, ok := invs[3].Func.(*ast.FuncLit); !ok {
+		t.Errorf("got %T", invs[3].Func)
+	}
+
+	if inv := invs[4]; inv.Func != nil || inv.Invocant != nil || inv.Recv == nil {
+		t.Errorf("got %+v", inv)
+	}
+
+	invs = pkg.InvocationsOf(flush, InvocationsViaInterfaces)
+	if len(invs) != 6 {
+		t.Fatalf("got %d", len(invs))
+	}
+	if inv := invs[4]; inv.Interface == nil || inv.Interface.Name() != "Flush" || inv.Invocant.Name() != "f" || inv.Func.(*ast.FuncDecl).Name.Name != "dispatched" {
+		t.Errorf("got %+v", inv)
+	}
+
+	// os.File doesn't implement flusher
+	if invs := pkg.InvocationsOf(pkg.LookupObject("os.File.Close"), InvocationsViaInterfaces); len(invs) != 0 {
+		t.Errorf("got %v", invs)
+	}
+}
+
 func TestDeclOf(t *testing.T) {
 	foo := Pkgs("github.com/retailnext/stan/internal/foo")[0]
 
@@ -0,0 +1,588 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/objectpath"
+)
+
+// AnalyzerCheck() wraps a, an analysis.Analyzer such as the ones in
+// golang.org/x/tools/go/analysis/passes, in a Check named after a, so it
+// can be run with Run(), RunChecks() or Main():
+//
+//	stan.Run(t, []string{"your/namespace/..."}, stan.AnalyzerCheck(nilness.Analyzer))
+//
+// See RunAnalyzer() for how a is run. Errors running a are reported as
+// diagnostics.
+func AnalyzerCheck(a *analysis.Analyzer) *Check {
+	return &Check{
+		Name: a.Name,
+		Doc:  a.Doc,
+		Func: func(pkg *Package, r Reporter) {
+			diags, err := RunAnalyzer(pkg, a)
+			for _, d := range diags {
+				r.Report(d)
+			}
+			if err != nil {
+				d := Diagnostic{Message: err.Error()}
+				if files := pkg.BuildFiles(); len(files) > 0 {
+					d.Pos = pkg.Pos(files[0].Name)
+				}
+				r.Report(d)
+			}
+		},
+	}
+}
+
+// RunAnalyzer() runs a on pkg, after running the analyzers a requires, and
+// returns a's diagnostics. If a (or an analyzer it requires) uses facts,
+// they are first computed for each of pkg's transitive imports by type
+// checking the imports from source, without their tests, with pkg's Loader.
+// Only the analyzers using facts, and what they require, run on imports.
+// Imports that fail to type check contribute no facts. Facts are cached by
+// the Loader until it is reset or packages are invalidated.
+func RunAnalyzer(pkg *Package, a *analysis.Analyzer) ([]Diagnostic, error) {
+	if err := analysis.Validate([]*analysis.Analyzer{a}); err != nil {
+		return nil, err
+	}
+
+	facts := pkg.loader.analysisFacts()
+
+	// analyzers using facts, and what they require, must see the
+	// dependencies first
+	var factAnalyzers []*analysis.Analyzer
+	for _, dep := range requiredAnalyzers(a) {
+		if len(dep.FactTypes) > 0 {
+			factAnalyzers = append(factAnalyzers, requiredAnalyzers(dep)...)
+		}
+	}
+	if len(factAnalyzers) > 0 {
+		pkg.loader.analyzeImports(pkg.TypesPkg, dedupeAnalyzers(factAnalyzers), facts, make(map[string]bool))
+	}
+
+	var diags []Diagnostic
+	err := runAnalyzers(pkg, requiredAnalyzers(a), facts, func(from *analysis.Analyzer, d analysis.Diagnostic) {
+		if from == a {
+			diags = append(diags, diagnosticFromAnalysis(pkg.Fset, a.Name, d))
+		}
+	})
+	return diags, err
+}
+
+// requiredAnalyzers returns a and the analyzers it transitively requires,
+// each after its requirements.
+func requiredAnalyzers(a *analysis.Analyzer) []*analysis.Analyzer {
+	var (
+		ret  []*analysis.Analyzer
+		seen = make(map[*analysis.Analyzer]bool)
+		add  func(*analysis.Analyzer)
+	)
+	add = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+		for _, req := range a.Requires {
+			add(req)
+		}
+		ret = append(ret, a)
+	}
+	add(a)
+	return ret
+}
+
+func dedupeAnalyzers(analyzers []*analysis.Analyzer) []*analysis.Analyzer {
+	var (
+		ret  []*analysis.Analyzer
+		seen = make(map[*analysis.Analyzer]bool)
+	)
+	for _, a := range analyzers {
+		if !seen[a] {
+			seen[a] = true
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// analyzeImports runs analyzers on tPkg's transitive imports, dependencies
+// first, to compute their facts.
+func (l *Loader) analyzeImports(tPkg *types.Package, analyzers []*analysis.Analyzer, facts *analysisFacts, visited map[string]bool) {
+	for _, imp := range tPkg.Imports() {
+		path := imp.Path()
+		if visited[path] || path == "unsafe" || path == "C" {
+			continue
+		}
+		visited[path] = true
+
+		l.analyzeImports(imp, analyzers, facts, visited)
+
+		var todo []*analysis.Analyzer
+		for _, a := range analyzers {
+			if !facts.isAnalyzed(a, path) {
+				todo = append(todo, a)
+			}
+		}
+		if len(todo) == 0 {
+			continue
+		}
+
+		if dep, err := l.dependencyPackage(path); err == nil {
+			// no diagnostics for dependencies, and without all facts the
+			// ones importing path can do without these too
+			runAnalyzers(dep, todo, facts, func(*analysis.Analyzer, analysis.Diagnostic) {})
+		}
+
+		for _, a := range todo {
+			facts.setAnalyzed(a, path)
+		}
+	}
+}
+
+// dependencyPackage type checks the package path, without its tests, for
+// computing facts. Unlike LoadPkgs(), it doesn't cache the package or check
+// it for each of l.BuildConfigs, and it imports the packages l's packages
+// see.
+func (l *Loader) dependencyPackage(path string) (*Package, error) {
+	info := newTypesInfo()
+	// path is resolved already, so any directory of l's module will do
+	tPkg, files, err := l.imp.checkSource(path, l.localDir("."), info)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &ast.Package{
+		Name:  tPkg.Name(),
+		Files: make(map[string]*ast.File),
+	}
+	for _, f := range files {
+		node.Files[l.fset.File(f.Pos()).Name()] = f
+	}
+
+	ret := l.newPackage(node, l.fset, info, tPkg)
+	ret.buildFiles = files
+	return ret, nil
+}
+
+// runAnalyzers runs analyzers, ordered requirements first, on pkg.
+func runAnalyzers(pkg *Package, analyzers []*analysis.Analyzer, facts *analysisFacts, report func(*analysis.Analyzer, analysis.Diagnostic)) error {
+	// non-buildable files may not be fully type checked
+	files := pkg.BuildFiles()
+
+	// packages visible to pkg, to resolve facts of other packages
+	visible := make(map[string]*types.Package)
+	var addVisible func(*types.Package)
+	addVisible = func(tPkg *types.Package) {
+		if visible[tPkg.Path()] != nil {
+			return
+		}
+		visible[tPkg.Path()] = tPkg
+		for _, imp := range tPkg.Imports() {
+			addVisible(imp)
+		}
+	}
+	addVisible(pkg.TypesPkg)
+
+	// facts of objects objectpath can't name, which stay within pkg
+	localFacts := make(map[localFactKey]analysis.Fact)
+
+	results := make(map[*analysis.Analyzer]interface{})
+
+	for _, a := range analyzers {
+		a := a
+
+		resultOf := make(map[*analysis.Analyzer]interface{})
+		for _, req := range a.Requires {
+			resultOf[req] = results[req]
+		}
+
+		checkFactType := func(fact analysis.Fact) {
+			for _, ft := range a.FactTypes {
+				if reflect.TypeOf(ft) == reflect.TypeOf(fact) {
+					return
+				}
+			}
+			panic(fmt.Sprintf("analyzer %s used fact type %T not in its FactTypes", a.Name, fact))
+		}
+
+		pass := &analysis.Pass{
+			Analyzer:   a,
+			Fset:       pkg.Fset,
+			Files:      files,
+			Pkg:        pkg.TypesPkg,
+			TypesInfo:  pkg.TypesInfo,
+			TypesSizes: types.SizesFor("gc", pkg.loader.Context.GOARCH),
+			ResultOf:   resultOf,
+			Report: func(d analysis.Diagnostic) {
+				report(a, d)
+			},
+			ReadFile: pkg.loader.overlay.readFile,
+
+			ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+				checkFactType(fact)
+				if obj == nil || obj.Pkg() == nil {
+					return false
+				}
+				if path, err := objectpath.For(obj); err == nil {
+					return facts.get(factKey{obj.Pkg().Path(), path, reflect.TypeOf(fact)}, fact)
+				}
+				return copyFact(localFacts[localFactKey{obj, reflect.TypeOf(fact)}], fact)
+			},
+			ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+				checkFactType(fact)
+				if obj.Pkg() != pkg.TypesPkg {
+					panic(fmt.Sprintf("analyzer %s exported a fact about %s of another package", a.Name, obj))
+				}
+				if path, err := objectpath.For(obj); err == nil {
+					facts.set(factKey{obj.Pkg().Path(), path, reflect.TypeOf(fact)}, fact)
+					return
+				}
+				localFacts[localFactKey{obj, reflect.TypeOf(fact)}] = fact
+			},
+			ImportPackageFact: func(tPkg *types.Package, fact analysis.Fact) bool {
+				checkFactType(fact)
+				return facts.get(factKey{pkg: tPkg.Path(), typ: reflect.TypeOf(fact)}, fact)
+			},
+			ExportPackageFact: func(fact analysis.Fact) {
+				checkFactType(fact)
+				facts.set(factKey{pkg: pkg.TypesPkg.Path(), typ: reflect.TypeOf(fact)}, fact)
+			},
+			AllObjectFacts: func() []analysis.ObjectFact {
+				var ret []analysis.ObjectFact
+				for key, fact := range facts.all(a.FactTypes) {
+					if key.obj == "" || visible[key.pkg] == nil {
+						continue
+					}
+					obj, err := objectpath.Object(visible[key.pkg], key.obj)
+					if err != nil {
+						continue
+					}
+					ret = append(ret, analysis.ObjectFact{Object: obj, Fact: fact})
+				}
+				for key, fact := range localFacts {
+					for _, ft := range a.FactTypes {
+						if reflect.TypeOf(ft) == key.typ {
+							ret = append(ret, analysis.ObjectFact{Object: key.obj, Fact: fact})
+						}
+					}
+				}
+				return ret
+			},
+			AllPackageFacts: func() []analysis.PackageFact {
+				var ret []analysis.PackageFact
+				for key, fact := range facts.all(a.FactTypes) {
+					if key.obj == "" && visible[key.pkg] != nil {
+						ret = append(ret, analysis.PackageFact{Package: visible[key.pkg], Fact: fact})
+					}
+				}
+				return ret
+			},
+		}
+
+		passPackages.Store(pass, pkg)
+		result, err := a.Run(pass)
+		passPackages.Delete(pass)
+		if err != nil {
+			return fmt.Errorf("analyzer %s failed on %s: %s", a.Name, pkg.Path(), err)
+		}
+		results[a] = result
+	}
+
+	return nil
+}
+
+// factKey identifies a fact about an object (named by its object path) or,
+// if obj is empty, about a package.
+type factKey struct {
+	pkg string
+	obj objectpath.Path
+	typ reflect.Type
+}
+
+type localFactKey struct {
+	obj types.Object
+	typ reflect.Type
+}
+
+// analysisFacts are the facts analyzers exported for a Loader's packages,
+// keyed by package path and object path since dependencies loaded to
+// compute facts aren't the *types.Package their importers see.
+type analysisFacts struct {
+	mu       sync.Mutex
+	facts    map[factKey]analysis.Fact
+	analyzed map[analyzedKey]bool
+}
+
+type analyzedKey struct {
+	analyzer *analysis.Analyzer
+	path     string
+}
+
+func (l *Loader) analysisFacts() *analysisFacts {
+	l.factsMu.Lock()
+	defer l.factsMu.Unlock()
+
+	if l.facts == nil {
+		l.facts = &analysisFacts{
+			facts:    make(map[factKey]analysis.Fact),
+			analyzed: make(map[analyzedKey]bool),
+		}
+	}
+	return l.facts
+}
+
+// dropAnalysisFacts forgets all facts. Facts are cheap to compute again
+// compared to tracking which depend on what.
+func (l *Loader) dropAnalysisFacts() {
+	l.factsMu.Lock()
+	l.facts = nil
+	l.factsMu.Unlock()
+}
+
+func (f *analysisFacts) get(key factKey, fact analysis.Fact) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyFact(f.facts[key], fact)
+}
+
+func (f *analysisFacts) set(key factKey, fact analysis.Fact) {
+	f.mu.Lock()
+	f.facts[key] = fact
+	f.mu.Unlock()
+}
+
+// all returns the facts of factTypes.
+func (f *analysisFacts) all(factTypes []analysis.Fact) map[factKey]analysis.Fact {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ret := make(map[factKey]analysis.Fact)
+	for key, fact := range f.facts {
+		for _, ft := range factTypes {
+			if reflect.TypeOf(ft) == key.typ {
+				ret[key] = fact
+			}
+		}
+	}
+	return ret
+}
+
+func (f *analysisFacts) isAnalyzed(a *analysis.Analyzer, path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.analyzed[analyzedKey{a, path}]
+}
+
+func (f *analysisFacts) setAnalyzed(a *analysis.Analyzer, path string) {
+	f.mu.Lock()
+	f.analyzed[analyzedKey{a, path}] = true
+	f.mu.Unlock()
+}
+
+// copyFact copies from into to, which point to the same fact type.
+func copyFact(from, to analysis.Fact) bool {
+	if from == nil {
+		return false
+	}
+	reflect.ValueOf(to).Elem().Set(reflect.ValueOf(from).Elem())
+	return true
+}
+
+func diagnosticFromAnalysis(fset *token.FileSet, check string, d analysis.Diagnostic) Diagnostic {
+	ret := Diagnostic{
+		Pos:     fset.Position(d.Pos),
+		Check:   check,
+		Message: d.Message,
+	}
+	if d.End.IsValid() {
+		ret.End = fset.Position(d.End)
+	}
+	for _, rel := range d.Related {
+		ret.Related = append(ret.Related, RelatedInformation{
+			Pos:     fset.Position(rel.Pos),
+			Message: rel.Message,
+		})
+	}
+	for _, fix := range d.SuggestedFixes {
+		sf := SuggestedFix{Message: fix.Message}
+		for _, e := range fix.TextEdits {
+			end := e.End
+			if !end.IsValid() {
+				end = e.Pos
+			}
+			sf.TextEdits = append(sf.TextEdits, TextEdit{
+				Pos:     fset.Position(e.Pos),
+				End:     fset.Position(end),
+				NewText: e.NewText,
+			})
+		}
+		ret.SuggestedFixes = append(ret.SuggestedFixes, sf)
+	}
+	return ret
+}
+
+// Analyzer() returns an analysis.Analyzer running c, so c can be used with
+// drivers such as singlechecker, multichecker, unitchecker or gopls. The
+// analyzer honors //stan:ignore suppressions. c's name is made a valid
+// identifier if needed. Analyzer() returns the same analyzer every time.
+func (c *Check) Analyzer() *analysis.Analyzer {
+	c.analyzerOnce.Do(func() {
+		doc := c.Doc
+		if doc == "" {
+			doc = "stan check " + c.Name
+		}
+
+		c.analyzer = &analysis.Analyzer{
+			Name: analyzerName(c.Name),
+			Doc:  doc,
+			Run: func(pass *analysis.Pass) (interface{}, error) {
+				pkg := packageOfPass(pass)
+				files := passFiles(pass)
+				for _, d := range RunChecks(pkg, c) {
+					pass.Report(diagnosticToAnalysis(files, d))
+				}
+				return nil, nil
+			},
+		}
+	})
+	return c.analyzer
+}
+
+func analyzerName(name string) string {
+	ret := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if ret == "" || ret[0] >= '0' && ret[0] <= '9' {
+		ret = "_" + ret
+	}
+	return ret
+}
+
+// passPackages maps the passes of runAnalyzers to their *Package, so checks
+// run as analyzers by stan see the caller's Loader.
+var passPackages sync.Map
+
+// passLoader is the Loader of the packages made by packageOfPass for passes
+// of other drivers, shared by all passes seeing the same copies of their
+// imports.
+var passLoader struct {
+	sync.Mutex
+	l *Loader
+}
+
+// packageOfPass returns the *Package of pass. For passes of other drivers,
+// it makes one out of pass's syntax and type information, whose Loader
+// imports pass.Pkg's dependencies as pass sees them.
+func packageOfPass(pass *analysis.Pass) *Package {
+	if pkg, ok := passPackages.Load(pass); ok {
+		return pkg.(*Package)
+	}
+
+	var deps []*types.Package
+	seen := make(map[*types.Package]bool)
+	var addImports func(*types.Package)
+	addImports = func(tPkg *types.Package) {
+		for _, imp := range tPkg.Imports() {
+			if !seen[imp] {
+				seen[imp] = true
+				deps = append(deps, imp)
+				addImports(imp)
+			}
+		}
+	}
+	addImports(pass.Pkg)
+
+	passLoader.Lock()
+	l := passLoader.l
+	for _, dep := range deps {
+		if l == nil {
+			break
+		}
+		if known := l.imp.lookup(dep.Path()); known != nil && known != dep {
+			// e.g. the driver loaded the packages again
+			l = nil
+		}
+	}
+	if l == nil {
+		l = NewLoader(build.Default)
+		l.init()
+		passLoader.l = l
+	}
+	for _, dep := range deps {
+		l.imp.add(dep.Path(), dep)
+	}
+	passLoader.Unlock()
+
+	node := &ast.Package{
+		Name:  pass.Pkg.Name(),
+		Files: make(map[string]*ast.File),
+	}
+	for _, f := range pass.Files {
+		node.Files[pass.Fset.File(f.Pos()).Name()] = f
+	}
+
+	ret := l.newPackage(node, pass.Fset, pass.TypesInfo, pass.Pkg)
+	ret.buildFiles = pass.Files
+	return ret
+}
+
+func diagnosticToAnalysis(files map[string]*token.File, d Diagnostic) analysis.Diagnostic {
+	ret := analysis.Diagnostic{
+		Pos:      tokenPos(files, d.Pos),
+		End:      tokenPos(files, d.End),
+		Category: d.Check,
+		Message:  d.Message,
+	}
+	for _, rel := range d.Related {
+		ret.Related = append(ret.Related, analysis.RelatedInformation{
+			Pos:     tokenPos(files, rel.Pos),
+			Message: rel.Message,
+		})
+	}
+	for _, fix := range d.SuggestedFixes {
+		sf := analysis.SuggestedFix{Message: fix.Message}
+		for _, e := range fix.TextEdits {
+			sf.TextEdits = append(sf.TextEdits, analysis.TextEdit{
+				Pos:     tokenPos(files, e.Pos),
+				End:     tokenPos(files, e.End),
+				NewText: e.NewText,
+			})
+		}
+		ret.SuggestedFixes = append(ret.SuggestedFixes, sf)
+	}
+	return ret
+}
+
+// passFiles returns pass's files by name, for tokenPos.
+func passFiles(pass *analysis.Pass) map[string]*token.File {
+	ret := make(map[string]*token.File, len(pass.Files))
+	for _, f := range pass.Files {
+		if tf := pass.Fset.File(f.Pos()); tf != nil {
+			ret[tf.Name()] = tf
+		}
+	}
+	return ret
+}
+
+// tokenPos returns the token.Pos of pos in files, or token.NoPos.
+func tokenPos(files map[string]*token.File, pos token.Position) token.Pos {
+	f := files[pos.Filename]
+	if !pos.IsValid() || f == nil || pos.Offset > f.Size() {
+		return token.NoPos
+	}
+	return f.Pos(pos.Offset)
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/build"
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+type sleepsFact struct{}
+
+func (*sleepsFact) AFact() {}
+
+func (*sleepsFact) String() string { return "sleeps" }
+
+// sleepAnalyzer reports calls to functions that (transitively) call
+// time.Sleep, using facts to see through other packages.
+var sleepAnalyzer = &analysis.Analyzer{
+	Name:      "sleepy",
+	Doc:       "report calls of functions that sleep",
+	Requires:  []*analysis.Analyzer{inspect.Analyzer},
+	FactTypes: []analysis.Fact{new(sleepsFact)},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		sleeps := func(fn *types.Func) bool {
+			if fn.Pkg() != nil && fn.Pkg().Path() == "time" && fn.Name() == "Sleep" {
+				return true
+			}
+			return pass.ImportObjectFact(fn, new(sleepsFact))
+		}
+
+		ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+		ins.WithStack([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+			if !push {
+				return true
+			}
+
+			var fn *types.Func
+			switch fun := n.(*ast.CallExpr).Fun.(type) {
+			case *ast.Ident:
+				fn, _ = pass.TypesInfo.Uses[fun].(*types.Func)
+			case *ast.SelectorExpr:
+				fn, _ = pass.TypesInfo.Uses[fun.Sel].(*types.Func)
+			}
+			if fn == nil || !sleeps(fn) {
+				return true
+			}
+
+			pass.Reportf(n.Pos(), "call of %s sleeps", fn.Name())
+
+			for i := len(stack) - 1; i >= 0; i-- {
+				if decl, ok := stack[i].(*ast.FuncDecl); ok {
+					pass.ExportObjectFact(pass.TypesInfo.Defs[decl.Name], new(sleepsFact))
+					break
+				}
+			}
+			return true
+		})
+		return nil, nil
+	},
+}
+
+func TestRunAnalyzer(t *testing.T) {
+	dir := writeModule(t, "example.com/facts", map[string]string{
+		"a/a.go": `package a
+
+import "time"
+
+func Nap() {
+	time.Sleep(time.Second)
+}
+`,
+		// facts don't need tests, so a broken one doesn't matter
+		"a/a_test.go": `package a
+
+var broken int = "broken"
+`,
+		"b/b.go": `package b
+
+import "example.com/facts/a"
+
+func Rest() {
+	a.Nap()
+}
+`,
+	})
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+
+	b := l.Pkgs("example.com/facts/b")[0]
+
+	diags, err := RunAnalyzer(b, sleepAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Message != "call of Nap sleeps" || diags[0].Check != "sleepy" || diags[0].Pos.Line != 6 {
+		t.Errorf("got %v", diags)
+	}
+
+	if _, found := l.packagesCache["example.com/facts/a"]; found {
+		t.Error("expected a to be checked for facts only")
+	}
+
+	// diagnostics of dependencies aren't reported
+	check := AnalyzerCheck(sleepAnalyzer)
+	if diags := RunChecks(b, check); len(diags) != 1 {
+		t.Errorf("got %v", diags)
+	}
+}
+
+func TestAnalyzerCheck(t *testing.T) {
+	ExpectDiagnostics(t, AnalyzerCheck(printf.Analyzer).Diagnose, `
+package fake
+
+import "fmt"
+
+func logf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+func foo() {
+	fmt.Printf("%d", "one") // want "format %d has arg \"one\" of wrong type string"
+	logf("%s")              // want "format %s reads arg #1, but call has 0 args"
+}
+`)
+}
+
+func TestCheckAnalyzer(t *testing.T) {
+	a := noBadCheck.Analyzer()
+	if err := analysis.Validate([]*analysis.Analyzer{a}); err != nil {
+		t.Fatal(err)
+	}
+	if a != noBadCheck.Analyzer() {
+		t.Error("expected the same analyzer")
+	}
+	if got := analyzerName("stan:ignore"); got != "stan_ignore" {
+		t.Errorf("got %s", got)
+	}
+
+	pkg := EvalPkg(`
+package fake
+
+var badOne = 1
+
+var badTwo = 2 //stan:ignore nobad testing
+`)
+
+	var diags []analysis.Diagnostic
+	pass := &analysis.Pass{
+		Analyzer:  a,
+		Fset:      pkg.Fset,
+		Files:     pkg.BuildFiles(),
+		Pkg:       pkg.TypesPkg,
+		TypesInfo: pkg.TypesInfo,
+		Report: func(d analysis.Diagnostic) {
+			diags = append(diags, d)
+		},
+	}
+	if _, err := a.Run(pass); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diags) != 1 || diags[0].Message != "don't name things badOne" || pkg.Fset.Position(diags[0].Pos).Line != 4 || diags[0].End != diags[0].Pos+6 {
+		t.Errorf("got %+v", diags)
+	}
+
+	if packageOfPass(pass).loader != packageOfPass(pass).loader {
+		t.Error("expected passes to share a loader")
+	}
+
+	// passes run by stan see the caller's package
+	var got *Package
+	_, err := RunAnalyzer(pkg, &analysis.Analyzer{
+		Name: "capture",
+		Doc:  "capture the pass's package",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			got = packageOfPass(pass)
+			return nil, nil
+		},
+	})
+	if err != nil || got != pkg {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Baseline is a set of accepted findings, so that a check added to an old
+// code base only fails for new ones. Findings are identified by a
+// fingerprint that survives unrelated edits; see Package.Fingerprint().
+type Baseline struct {
+	Entries []*BaselineEntry `json:"entries"`
+
+	byFingerprint map[string]*BaselineEntry
+	matched       map[*BaselineEntry]int
+}
+
+// BaselineEntry is an accepted finding.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Check       string `json:"check"`
+	Package     string `json:"package"`
+	// Spec of the enclosing declaration, as taken by LookupObject(), or the
+	// package path outside of declarations
+	Object string `json:"object"`
+	// For humans reading the baseline; not part of the fingerprint
+	Message string `json:"message"`
+	// Number of findings with this fingerprint
+	Count int `json:"count"`
+}
+
+// NewBaseline() returns an empty Baseline.
+func NewBaseline() *Baseline {
+	return &Baseline{}
+}
+
+// ReadBaseline() reads a baseline written by Baseline.WriteFile(). A missing
+// file yields an empty Baseline.
+func ReadBaseline(filename string) (*Baseline, error) {
+	b := NewBaseline()
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteFile() writes b to filename as JSON, ordered so that the file diffs
+// nicely.
+func (b *Baseline) WriteFile(filename string) error {
+	sort.Slice(b.Entries, func(i, j int) bool {
+		ei, ej := b.Entries[i], b.Entries[j]
+		if ei.Package != ej.Package {
+			return ei.Package < ej.Package
+		}
+		if ei.Check != ej.Check {
+			return ei.Check < ej.Check
+		}
+		if ei.Object != ej.Object {
+			return ei.Object < ej.Object
+		}
+		return ei.Fingerprint < ej.Fingerprint
+	})
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func (b *Baseline) index() {
+	if b.byFingerprint != nil {
+		return
+	}
+	b.byFingerprint = make(map[string]*BaselineEntry)
+	b.matched = make(map[*BaselineEntry]int)
+	for _, e := range b.Entries {
+		b.byFingerprint[e.Fingerprint] = e
+	}
+}
+
+// Add() accepts diags, findings in pkg.
+func (b *Baseline) Add(pkg *Package, diags ...Diagnostic) {
+	b.index()
+
+	for _, d := range diags {
+		fp, object := pkg.fingerprint(d)
+
+		if e := b.byFingerprint[fp]; e != nil {
+			e.Count++
+			continue
+		}
+
+		e := &BaselineEntry{
+			Fingerprint: fp,
+			Check:       d.Check,
+			Package:     pkg.Path(),
+			Object:      object,
+			Message:     d.Message,
+			Count:       1,
+		}
+		b.Entries = append(b.Entries, e)
+		b.byFingerprint[fp] = e
+	}
+}
+
+// Filter() returns the diagnostics of pkg that are not in b. Each entry
+// accepts as many findings as its Count, counting the findings accepted by
+// earlier calls, so that the checks of a run can be filtered one at a time
+// and Stale() reports the entries that are left. Call Reset() before
+// filtering the findings of another run.
+func (b *Baseline) Filter(pkg *Package, diags []Diagnostic) []Diagnostic {
+	b.index()
+
+	var ret []Diagnostic
+	for _, d := range diags {
+		fp, _ := pkg.fingerprint(d)
+		if e := b.byFingerprint[fp]; e != nil && b.matched[e] < e.Count {
+			b.matched[e]++
+			continue
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+// Reset() forgets the findings accepted by Filter() so far.
+func (b *Baseline) Reset() {
+	b.index()
+	b.matched = make(map[*BaselineEntry]int)
+}
+
+// Stale() returns the entries of b for packages and checks that accepted
+// fewer findings in Filter() than their Count, i.e. findings that have been
+// fixed (or changed) since and can be pruned. Only entries of pkgPaths and
+// checks are returned; if either is empty, all are.
+func (b *Baseline) Stale(pkgPaths, checks []string) []*BaselineEntry {
+	b.index()
+
+	in := func(s string, list []string) bool {
+		if len(list) == 0 {
+			return true
+		}
+		for _, l := range list {
+			if l == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ret []*BaselineEntry
+	for _, e := range b.Entries {
+		if b.matched[e] < e.Count && in(e.Package, pkgPaths) && in(e.Check, checks) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Fingerprint() returns an identifier for d, a finding in p, that doesn't
+// change with unrelated edits such as moving code around. It hashes d's
+// check, the spec of the declaration enclosing d and d's code with
+// formatting normalized, but not d's position or message.
+func (p *Package) Fingerprint(d Diagnostic) string {
+	fp, _ := p.fingerprint(d)
+	return fp
+}
+
+func (p *Package) fingerprint(d Diagnostic) (fp, object string) {
+	object = p.Path()
+	var snippet string
+
+	if f := p.Files()[d.Pos.Filename]; f != nil {
+		tf := p.Fset.File(f.Pos())
+		if d.Pos.Offset <= tf.Size() {
+			start := tf.Pos(d.Pos.Offset)
+			end := start
+			if d.End.IsValid() && d.End.Filename == d.Pos.Filename && d.End.Offset >= d.Pos.Offset && d.End.Offset <= tf.Size() {
+				end = tf.Pos(d.End.Offset)
+			}
+
+			path, _ := astutil.PathEnclosingInterval(f, start, end)
+			object = p.enclosingDeclSpec(path)
+			snippet = p.snippet(path)
+		}
+	}
+
+	h := sha256.New()
+	for _, s := range []string{d.Check, object, snippet} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:20], object
+}
+
+// enclosingDeclSpec returns the object spec of the top level declaration in
+// path, or p's path.
+func (p *Package) enclosingDeclSpec(path []ast.Node) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		switch n := path[i].(type) {
+		case *ast.FuncDecl:
+			if recv := recvTypeName(n); recv != "" {
+				return p.Path() + "." + recv + "." + n.Name.Name
+			}
+			return p.Path() + "." + n.Name.Name
+		case *ast.TypeSpec:
+			return p.Path() + "." + n.Name.Name
+		case *ast.ValueSpec:
+			return p.Path() + "." + n.Names[0].Name
+		}
+	}
+	return p.Path()
+}
+
+// recvTypeName returns the name of fn's receiver type, or "" if fn is not a
+// method.
+func recvTypeName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// snippet returns the formatted code of the innermost node in path, with
+// whitespace collapsed. Identifiers and literals are too short to tell
+// findings apart, so their parent is used instead.
+func (p *Package) snippet(path []ast.Node) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	n := path[0]
+	switch n.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		if len(path) > 1 {
+			n = path[1]
+		}
+	case *ast.File:
+		return ""
+	}
+
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		// just the signature, not the whole body
+		name := n.Name.Name
+		if recv := recvTypeName(n); recv != "" {
+			name = recv + "." + name
+		}
+		return "func " + name + strings.TrimPrefix(p.NodeString(n.Type), "func")
+	case *ast.BlockStmt, *ast.GenDecl:
+		return ""
+	}
+
+	return strings.Join(strings.Fields(p.NodeString(n)), " ")
+}
+
+// RunWithBaseline() is like Run(), but diagnostics accepted in the baseline
+// file baselineFile don't fail the test. Baseline entries that no longer
+// match anything are logged so they can be pruned. To accept all current
+// findings, run the test with STAN_UPDATE_BASELINE=1 in the environment,
+// which rewrites baselineFile instead of failing. Entries of packages that
+// fail to load are kept.
+//
+//	func TestStaticChecks(t *testing.T) {
+//	  stan.RunWithBaseline(t, "testdata/stan_baseline.json", []string{"your/namespace/..."}, TimeEqual)
+//	}
+func RunWithBaseline(t *testing.T, baselineFile string, patterns []string, checks ...*Check) {
+	t.Helper()
+
+	if len(checks) == 0 {
+		checks = Checks()
+	}
+
+	// report packages that failed to load, but still check the others
+	pkgs, err := LoadPkgs(patterns...)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if os.Getenv("STAN_UPDATE_BASELINE") != "" {
+		b := NewBaseline()
+		if loadErrs, _ := err.(LoadErrors); len(loadErrs) > 0 {
+			// keep the accepted findings of packages that failed to load
+			old, err := ReadBaseline(baselineFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			failed := make(map[string]bool)
+			for _, pe := range loadErrs {
+				failed[pe.Path] = true
+			}
+			for _, e := range old.Entries {
+				if failed[e.Package] {
+					b.Entries = append(b.Entries, e)
+				}
+			}
+		}
+		for _, pkg := range pkgs {
+			b.Add(pkg, RunChecks(pkg, checks...)...)
+		}
+		if err := b.WriteFile(baselineFile); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("wrote %d baseline entries to %s", len(b.Entries), baselineFile)
+		return
+	}
+
+	b, err := ReadBaseline(baselineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pkgPaths, checkNames []string
+	for _, pkg := range pkgs {
+		pkgPaths = append(pkgPaths, pkg.Path())
+	}
+
+	for i, c := range checks {
+		c := c
+		nameless := i == 0
+		checkNames = append(checkNames, c.Name)
+		t.Run(c.Name, func(t *testing.T) {
+			for _, pkg := range pkgs {
+				pkg := pkg
+				t.Run(pkg.Path(), func(t *testing.T) {
+					for _, d := range b.Filter(pkg, runChecks(pkg, []*Check{c}, nameless)) {
+						if d.Severity == SeverityError {
+							t.Error(d)
+						} else {
+							t.Logf("%s: %s", d.Severity, d)
+						}
+					}
+				})
+			}
+		})
+	}
+
+	for _, e := range b.Stale(pkgPaths, checkNames) {
+		t.Logf("stale baseline entry %s (%s in %s: %s), rerun with STAN_UPDATE_BASELINE=1 to prune", e.Fingerprint, e.Check, e.Object, e.Message)
+	}
+}
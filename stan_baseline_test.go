@@ -0,0 +1,110 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	old := EvalPkg(`
+package fake
+
+var badOne = 1
+
+func f() {
+	badTwo := 2
+	_ = badTwo
+}
+
+type T struct{}
+
+func (*T) m() {
+	badThree, badFour := 3, 4
+	_, _ = badThree, badFour
+}
+`)
+
+	oldDiags := noBadCheck.Diagnose(old)
+	if len(oldDiags) != 7 {
+		t.Fatalf("got %v", oldDiags)
+	}
+
+	b := NewBaseline()
+	b.Add(old, oldDiags...)
+	if len(b.Entries) != 5 {
+		t.Fatalf("got %d entries", len(b.Entries))
+	}
+
+	dir, err := ioutil.TempDir("", "stan_baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "baseline.json")
+	if err := b.WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ReadBaseline(name); err != nil {
+		t.Fatal(err)
+	}
+	// entries are sorted by package, check and object; both identifiers
+	// of the same statement share a fingerprint
+	if e := b.Entries[0]; e.Object != old.Path()+".T.m" || e.Check != "nobad" || e.Count != 2 {
+		t.Errorf("got %+v", e)
+	}
+
+	// code moved around and reformatted, badOne fixed, badFive added
+	pkg := EvalPkg(`
+package fake
+
+type T struct{}
+
+func (*T) m() {
+	badThree,   badFour := 3, 4
+	_, _ = badThree, badFour
+}
+
+var goodOne = 1
+
+func f() {
+	badTwo := 2
+
+
+	_ = badTwo
+	badFive := 5
+	_ = badFive
+}
+`)
+
+	diags := b.Filter(pkg, noBadCheck.Diagnose(pkg))
+	if len(diags) != 2 || diags[0].Message != "don't name things badFive" || diags[1].Message != "don't name things badFive" {
+		t.Errorf("got %v", diags)
+	}
+
+	stale := b.Stale([]string{pkg.Path()}, nil)
+	if len(stale) != 1 || stale[0].Message != "don't name things badOne" {
+		t.Errorf("got %+v", stale)
+	}
+	if stale := b.Stale(nil, []string{"other"}); len(stale) != 0 {
+		t.Errorf("got %+v", stale)
+	}
+
+	// the accepted findings are used up until Reset()
+	if diags := b.Filter(pkg, noBadCheck.Diagnose(pkg)); len(diags) != 8 {
+		t.Errorf("got %v", diags)
+	}
+	b.Reset()
+	if diags := b.Filter(pkg, noBadCheck.Diagnose(pkg)); len(diags) != 2 {
+		t.Errorf("got %v", diags)
+	}
+
+	if missing, err := ReadBaseline(filepath.Join(dir, "missing.json")); err != nil || len(missing.Entries) != 0 {
+		t.Errorf("got %v, %v", missing, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/types"
+	"strings"
+)
+
+// BuildConfig is a GOOS/GOARCH/build tag combination to type check packages
+// for. When a Loader has BuildConfigs, each package is type checked once per
+// distinct set of buildable files and type sizes (see types.SizesFor()) and
+// the results are merged into a single *Package:
+//   - objects keep their original names (no "_nobuild" renaming)
+//   - BuildConfigsOf() reports which configurations an object exists in
+//   - Variants() gives the per-configuration *Packages
+//
+// Files not buildable in any of the configurations are left out. Objects of
+// different configurations have distinct types (e.g. a type declared in a
+// file shared by all configurations is not types.Identical across them), so
+// use Variants() for type based queries.
+type BuildConfig struct {
+	GOOS   string
+	GOARCH string
+	// Additional build tags, as in build.Context.BuildTags.
+	Tags []string
+}
+
+// String() returns c as "GOOS/GOARCH" followed by any tags, separated by
+// commas.
+func (c BuildConfig) String() string {
+	return strings.Join(append([]string{c.GOOS + "/" + c.GOARCH}, c.Tags...), ",")
+}
+
+// configContext returns l.Context adjusted for cfg. cgo is only left enabled
+// if cfg matches l.Context's platform, since cgo can't run for other
+// platforms.
+func (l *Loader) configContext(cfg BuildConfig) build.Context {
+	ctxt := l.Context
+	if cfg.GOOS != ctxt.GOOS || cfg.GOARCH != ctxt.GOARCH {
+		ctxt.CgoEnabled = false
+	}
+	ctxt.GOOS, ctxt.GOARCH = cfg.GOOS, cfg.GOARCH
+	ctxt.BuildTags = append(append([]string(nil), l.Context.BuildTags...), cfg.Tags...)
+	return ctxt
+}
+
+// variant returns the Loader importing dependencies for cfg. Variants share
+// l's file set so positions from all configurations can be resolved with it.
+func (l *Loader) variant(cfg BuildConfig) *Loader {
+	l.variantsMu.Lock()
+	defer l.variantsMu.Unlock()
+
+	key := cfg.String()
+	if v := l.variants[key]; v != nil {
+		return v
+	}
+
+	v := &Loader{
+		Context:  l.configContext(cfg),
+		Dir:      l.Dir,
+		Overlay:  l.Overlay,
+		CacheDir: l.CacheDir,
+		fset:     l.fset,
+	}
+	v.init()
+
+	l.variants[key] = v
+
+	return v
+}
+
+// sizesKey identifies the types.Sizes of goarch by its word size and maximum
+// alignment, which is all the gc sizes differ in.
+func sizesKey(goarch string) string {
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return goarch
+	}
+	return fmt.Sprintf("%d/%d", sizes.Sizeof(types.Typ[types.Uintptr]), sizes.Alignof(types.Typ[types.Complex128]))
+}
+
+// typeCheckConfigs type checks pkg once for each distinct set of files and
+// sizes of l.BuildConfigs and merges the results.
+func (l *Loader) typeCheckConfigs(pkg *parsedPackage, wrapImporter func(types.ImporterFrom) types.ImporterFrom) (*Package, *PackageError) {
+	var (
+		keys    []string
+		configs = make(map[string][]BuildConfig)
+		files   = make(map[string][]*ast.File)
+	)
+
+	for ci, cfgFiles := range pkg.configFiles {
+		if len(cfgFiles) == 0 {
+			continue
+		}
+
+		var names []string
+		for _, f := range cfgFiles {
+			names = append(names, pkg.fset.Position(f.Pos()).Filename)
+		}
+		// configs with different sizes lay out types differently, so can't
+		// share a type check even with the same files
+		key := sizesKey(l.BuildConfigs[ci].GOARCH) + "\x00" + strings.Join(names, "\x00")
+
+		if _, found := configs[key]; !found {
+			keys = append(keys, key)
+			files[key] = cfgFiles
+		}
+		configs[key] = append(configs[key], l.BuildConfigs[ci])
+	}
+
+	var variants []*Package
+	for _, key := range keys {
+		checked, err := l.variant(configs[key][0]).checkFiles(pkg, files[key], wrapImporter)
+		if err != nil {
+			err.Err = fmt.Errorf("%s (%s)", err.Err, configs[key][0])
+			return nil, err
+		}
+		checked.configs = configs[key]
+		variants = append(variants, checked)
+	}
+
+	return l.mergeVariants(pkg, variants), nil
+}
+
+// mergeVariants combines the per-configuration packages into one *Package.
+// The first variant to declare an object provides the canonical
+// types.Object for it, which every variant's uses map to.
+func (l *Loader) mergeVariants(pkg *parsedPackage, variants []*Package) *Package {
+	var (
+		canon      = make(map[string]types.Object)
+		objConfigs = make(map[types.Object][]BuildConfig)
+		allConfigs []BuildConfig
+	)
+
+	canonical := func(obj types.Object, configs []BuildConfig) types.Object {
+		if obj == nil {
+			return nil
+		}
+
+		if pos := obj.Pos(); pos.IsValid() {
+			// the same declaration has a different token.Pos for each
+			// variant's importer, so compare file positions
+			fset := pkg.fset
+			if fset.File(pos) == nil {
+				fset = l.fset
+			}
+			var pkgPath string
+			if obj.Pkg() != nil {
+				pkgPath = obj.Pkg().Path()
+			}
+			// instantiated methods and fields share their generic
+			// object's position, but not its type
+			key := fmt.Sprintf("%T %s %s %s %s", obj, pkgPath, obj.Name(), fset.Position(pos), obj.Type())
+			if existing := canon[key]; existing != nil {
+				obj = existing
+			} else {
+				canon[key] = obj
+			}
+		}
+
+		objConfigs[obj] = appendConfigs(objConfigs[obj], configs)
+
+		return obj
+	}
+
+	info := newTypesInfo()
+
+	first := variants[0].TypesPkg
+	tPkg := types.NewPackage(first.Path(), first.Name())
+
+	var (
+		imports     []*types.Package
+		seenImports = make(map[string]bool)
+	)
+
+	for _, v := range variants {
+		allConfigs = appendConfigs(allConfigs, v.configs)
+
+		for expr, tv := range v.TypesInfo.Types {
+			if _, found := info.Types[expr]; !found {
+				info.Types[expr] = tv
+			}
+		}
+		for id, obj := range v.TypesInfo.Defs {
+			obj = canonical(obj, v.configs)
+			if _, found := info.Defs[id]; !found {
+				info.Defs[id] = obj
+			}
+		}
+		for id, obj := range v.TypesInfo.Uses {
+			obj = canonical(obj, v.configs)
+			if _, found := info.Uses[id]; !found {
+				info.Uses[id] = obj
+			}
+		}
+		for node, obj := range v.TypesInfo.Implicits {
+			obj = canonical(obj, v.configs)
+			if _, found := info.Implicits[node]; !found {
+				info.Implicits[node] = obj
+			}
+		}
+		for id, inst := range v.TypesInfo.Instances {
+			if _, found := info.Instances[id]; !found {
+				info.Instances[id] = inst
+			}
+		}
+		for node, scope := range v.TypesInfo.Scopes {
+			if _, found := info.Scopes[node]; !found {
+				info.Scopes[node] = scope
+			}
+		}
+		for sel, selection := range v.TypesInfo.Selections {
+			if _, found := info.Selections[sel]; !found {
+				info.Selections[sel] = selection
+			}
+		}
+		for f, version := range v.TypesInfo.FileVersions {
+			info.FileVersions[f] = version
+		}
+
+		scope := v.TypesPkg.Scope()
+		for _, name := range scope.Names() {
+			obj := canonical(scope.Lookup(name), v.configs)
+			if tPkg.Scope().Lookup(name) == nil {
+				tPkg.Scope().Insert(obj)
+			}
+		}
+
+		for _, imp := range v.TypesPkg.Imports() {
+			if !seenImports[imp.Path()] {
+				seenImports[imp.Path()] = true
+				imports = append(imports, imp)
+			}
+		}
+	}
+
+	tPkg.SetImports(imports)
+	tPkg.MarkComplete()
+
+	merged := l.newPackage(pkg.pkg, pkg.fset, info, tPkg)
+	merged.configs = allConfigs
+	merged.variants = variants
+	merged.objConfigs = objConfigs
+	for _, f := range pkg.pkg.Files {
+		// only files buildable in some configuration were kept
+		merged.buildFiles = append(merged.buildFiles, f)
+	}
+
+	return merged
+}
+
+func appendConfigs(configs []BuildConfig, more []BuildConfig) []BuildConfig {
+Configs:
+	for _, m := range more {
+		for _, c := range configs {
+			if c.String() == m.String() {
+				continue Configs
+			}
+		}
+		configs = append(configs, m)
+	}
+	return configs
+}
+
+// shareWithImporter makes p's *types.Package available to importers of p so
+// they don't import it again from source.
+func (p *Package) shareWithImporter() {
+	if p.variants == nil {
+		p.loader.imp.add(p.Path(), p.TypesPkg)
+		return
+	}
+
+	for _, v := range p.variants {
+		v.shareWithImporter()
+	}
+}
+
+// BuildConfigs() returns the build configurations p was type checked for, or
+// nil if p was not loaded using Loader.BuildConfigs.
+func (p *Package) BuildConfigs() []BuildConfig {
+	return p.configs
+}
+
+// BuildConfigsOf() returns the build configurations in which obj exists (is
+// declared or used by p), or nil if p was not loaded using
+// Loader.BuildConfigs.
+func (p *Package) BuildConfigsOf(obj types.Object) []BuildConfig {
+	return p.objConfigs[obj]
+}
+
+// Variants() returns a *Package for each distinct set of buildable files of
+// p, each type checked on its own. Use BuildConfigs() on a variant to see
+// which configurations it represents. Variants() returns nil if p was not
+// loaded using Loader.BuildConfigs.
+func (p *Package) Variants() []*Package {
+	return p.variants
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/build"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBuildConfigs(t *testing.T) {
+	l := NewLoader(build.Default)
+	l.BuildConfigs = []BuildConfig{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+		{GOOS: "darwin", GOARCH: "arm64"},
+		// same files as linux/amd64
+		{GOOS: "linux", GOARCH: "arm64"},
+	}
+
+	bar := l.Pkgs("github.com/retailnext/stan/internal/bar")[0]
+
+	if n := len(bar.Variants()); n != 3 {
+		t.Errorf("got %d variants", n)
+	}
+
+	if n := len(bar.BuildConfigs()); n != 4 {
+		t.Errorf("got %d configs", n)
+	}
+
+	got := make(map[string][]string)
+	bar.IterateObjects(func(o types.Object) {
+		// only package level objects
+		if o.Pkg() == nil || o.Parent() != o.Pkg().Scope() {
+			return
+		}
+		if strings.Contains(o.Name(), "nobuild") {
+			t.Errorf("got renamed object %s", o.Name())
+		}
+		var configs []string
+		for _, c := range bar.BuildConfigsOf(o) {
+			configs = append(configs, c.String())
+		}
+		sort.Strings(configs)
+		got[o.Name()] = append(got[o.Name()], strings.Join(configs, " "))
+	})
+
+	for _, configs := range got {
+		sort.Strings(configs)
+	}
+
+	expected := map[string][]string{
+		"BarType":         {"darwin/arm64 linux/amd64 linux/arm64 windows/amd64"},
+		"shared":          {"darwin/arm64", "linux/amd64 linux/arm64", "windows/amd64"},
+		"windowsDarwin":   {"darwin/arm64", "windows/amd64"},
+		"linuxSpecific":   {"linux/amd64 linux/arm64"},
+		"windowsSpecific": {"windows/amd64"},
+	}
+
+	for name, configs := range expected {
+		if !reflect.DeepEqual(got[name], configs) {
+			t.Errorf("%s: got %v, expected %v", name, got[name], configs)
+		}
+	}
+
+	// lookups see objects from every configuration
+	darwin := bar.LookupObject("github.com/retailnext/stan/internal/bar.darwinSpecific")
+	if configs := bar.BuildConfigsOf(darwin); len(configs) != 1 || configs[0].GOOS != "darwin" {
+		t.Errorf("got %v", configs)
+	}
+}
+
+func TestBuildConfigsSizes(t *testing.T) {
+	dir := writeModule(t, "example.com/sizes", map[string]string{
+		"sizes.go": `package sizes
+
+import "unsafe"
+
+const WordSize = unsafe.Sizeof(uintptr(0))
+`,
+	})
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+	l.BuildConfigs = []BuildConfig{
+		{GOOS: "linux", GOARCH: "amd64"},
+		// same sizes as linux/amd64
+		{GOOS: "linux", GOARCH: "arm64"},
+		{GOOS: "linux", GOARCH: "386"},
+	}
+
+	pkg := l.Pkgs("example.com/sizes")[0]
+
+	got := make(map[string]string)
+	for _, v := range pkg.Variants() {
+		wordSize := v.TypesPkg.Scope().Lookup("WordSize").(*types.Const).Val().String()
+		for _, c := range v.BuildConfigs() {
+			got[c.String()] = wordSize
+		}
+	}
+
+	expected := map[string]string{"linux/amd64": "8", "linux/arm64": "8", "linux/386": "4"}
+	if len(pkg.Variants()) != 2 || !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %d variants, %v", len(pkg.Variants()), got)
+	}
+}
@@ -0,0 +1,494 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// CallGraph is a static call graph of a set of packages. Dynamic calls are
+// resolved with class hierarchy analysis (CHA): a call of an interface
+// method may call the method of any type implementing the interface, and a
+// call of a function value may call any function literal, or function or
+// method used as a value, of the same signature. That over-approximates
+// what can really be called, but never misses a callee whose type is
+// known to the graph.
+//
+// Functions of packages that weren't loaded, such as the standard library,
+// are nodes without callees since their bodies are not available.
+type CallGraph struct {
+	// Nodes of functions and methods by types.Func.FullName(), since
+	// packages loaded separately may have distinct types.Func objects for
+	// the same function
+	funcs map[string]*CallNode
+	lits  map[*ast.FuncLit]*CallNode
+	inits map[*Package]*CallNode
+
+	// named types that dynamic calls of interface methods may dispatch to
+	concrete []types.Type
+	// function values that dynamic calls of function values may call
+	values []funcValue
+
+	implementers typeutil.Map // interface => []types.Type
+	valuesOfSig  typeutil.Map // *types.Signature => []*CallNode
+}
+
+// CallNode is a function in a CallGraph.
+type CallNode struct {
+	// Function or method, or nil for function literals and package
+	// initialization
+	Func *types.Func
+	// Function literal, if the node is one
+	Lit *ast.FuncLit
+	// Package containing the function's body, or nil if it wasn't loaded
+	Pkg *Package
+	// Name of the function like types.Func.FullName(); function literals
+	// are named after the enclosing function like "pkg.F$1", and package
+	// initialization (calls in package level variable declarations) is
+	// "pkg.init".
+	Name string
+
+	// Calls of the function
+	In []*CallEdge
+	// Calls made by the function
+	Out []*CallEdge
+
+	body *ast.BlockStmt
+}
+
+// CallEdge is a call from one CallNode to another. A call site has an edge
+// for each possible callee.
+type CallEdge struct {
+	Caller *CallNode
+	Callee *CallNode
+	// The call; use Pkg.Pos(Call) for its position
+	Call *ast.CallExpr
+	// Package containing Call
+	Pkg *Package
+	// Whether the call is through an interface method or function value
+	Dynamic bool
+}
+
+type funcValue struct {
+	node *CallNode
+	sig  *types.Signature
+}
+
+// String() returns n's name.
+func (n *CallNode) String() string {
+	return n.Name
+}
+
+// String() returns e as "caller -> callee at file:line:column".
+func (e *CallEdge) String() string {
+	return fmt.Sprintf("%s -> %s at %s", e.Caller, e.Callee, e.Pkg.Pos(e.Call))
+}
+
+// NewCallGraph() builds the call graph of pkgs, such as returned by Pkgs().
+// Call sites in pkgs are all considered; functions and types of packages
+// they import are candidates for dynamic calls.
+func NewCallGraph(pkgs ...*Package) *CallGraph {
+	g := &CallGraph{
+		funcs: make(map[string]*CallNode),
+		lits:  make(map[*ast.FuncLit]*CallNode),
+		inits: make(map[*Package]*CallNode),
+	}
+
+	for _, pkg := range pkgs {
+		g.addNodes(pkg)
+	}
+	g.addConcreteTypes(pkgs)
+	for _, pkg := range pkgs {
+		g.addEdges(pkg)
+	}
+
+	return g
+}
+
+// Node() returns the node of function or method fn, or nil if fn is not in
+// g. Node() panics if fn is not a *types.Func.
+func (g *CallGraph) Node(fn types.Object) *CallNode {
+	f, _ := fn.(*types.Func)
+	if f == nil {
+		panic(fmt.Sprintf("object %[1]s is not *types.Func (%[1]T)", fn))
+	}
+	return g.funcs[f.Origin().FullName()]
+}
+
+// CallersOf() returns the calls of function or method fn, in no particular
+// order. CallersOf() panics if fn is not a *types.Func.
+func (g *CallGraph) CallersOf(fn types.Object) []*CallEdge {
+	if n := g.Node(fn); n != nil {
+		return n.In
+	}
+	return nil
+}
+
+// CalleesOf() returns the calls made by function or method fn, in source
+// order. Calls made by function literals within fn are not included; see
+// Reachable(). CalleesOf() panics if fn is not a *types.Func.
+func (g *CallGraph) CalleesOf(fn types.Object) []*CallEdge {
+	if n := g.Node(fn); n != nil {
+		return n.Out
+	}
+	return nil
+}
+
+// Reachable() returns a shortest call path from function or method from
+// to function or method to, or nil if to is not reachable from from.
+// Function literals are considered reachable from the function they appear
+// in, so the path may contain edges with a nil Call from a function to a
+// literal it contains. Reachable() panics if from or to is not a
+// *types.Func.
+func (g *CallGraph) Reachable(from, to types.Object) []*CallEdge {
+	start, target := g.Node(from), g.Node(to)
+	if start == nil || target == nil {
+		return nil
+	}
+
+	via := map[*CallNode]*CallEdge{start: nil}
+	queue := []*CallNode{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		if n == target {
+			var path []*CallEdge
+			for e := via[n]; e != nil; e = via[e.Caller] {
+				path = append([]*CallEdge{e}, path...)
+			}
+			return path
+		}
+
+		for _, e := range g.successors(n) {
+			if _, seen := via[e.Callee]; !seen {
+				via[e.Callee] = e
+				queue = append(queue, e.Callee)
+			}
+		}
+	}
+	return nil
+}
+
+// successors returns n's outgoing edges, plus edges to the function
+// literals directly within n.
+func (g *CallGraph) successors(n *CallNode) []*CallEdge {
+	ret := n.Out
+
+	if n.body == nil {
+		return ret
+	}
+
+	ast.Inspect(n.body, func(c ast.Node) bool {
+		lit, _ := c.(*ast.FuncLit)
+		if lit == nil {
+			return true
+		}
+		if litNode := g.lits[lit]; litNode != nil {
+			ret = append(ret, &CallEdge{Caller: n, Callee: litNode, Pkg: n.Pkg})
+		}
+		return false
+	})
+	return ret
+}
+
+func (g *CallGraph) funcNode(fn *types.Func) *CallNode {
+	fn = fn.Origin()
+	name := fn.FullName()
+	if n := g.funcs[name]; n != nil {
+		return n
+	}
+	n := &CallNode{Func: fn, Name: name}
+	g.funcs[name] = n
+	return n
+}
+
+func (g *CallGraph) initNode(pkg *Package) *CallNode {
+	if n := g.inits[pkg]; n != nil {
+		return n
+	}
+	n := &CallNode{Pkg: pkg, Name: pkg.Path() + ".init"}
+	g.inits[pkg] = n
+	return n
+}
+
+// addNodes adds nodes for the functions, methods and function literals
+// declared in pkg, and records functions used as values.
+func (g *CallGraph) addNodes(pkg *Package) {
+	var initLits int
+	for _, f := range pkg.BuildFiles() {
+		for _, decl := range f.Decls {
+			fd, _ := decl.(*ast.FuncDecl)
+			if fd == nil {
+				continue
+			}
+			fn, _ := pkg.TypesInfo.Defs[fd.Name].(*types.Func)
+			if fn == nil {
+				continue
+			}
+
+			n := g.funcNode(fn)
+			n.Func, n.Pkg, n.body = fn, pkg, fd.Body
+
+			g.addLits(pkg, fd, n.Name, 0)
+		}
+
+		for _, decl := range f.Decls {
+			if gd, _ := decl.(*ast.GenDecl); gd != nil {
+				initLits = g.addLits(pkg, gd, pkg.Path()+".init", initLits)
+			}
+		}
+
+		WalkAST(f, func(node ast.Node, ancs Ancestors) {
+			var (
+				id   *ast.Ident
+				expr ast.Expr
+			)
+			switch x := node.(type) {
+			case *ast.Ident:
+				if sel, _ := ancs.Peek().(*ast.SelectorExpr); sel != nil && sel.Sel == x {
+					return
+				}
+				id, expr = x, x
+			case *ast.SelectorExpr:
+				id, expr = x.Sel, x
+				// callOf() wants the ancestors of the identifier
+				ancs = append(ancs[:len(ancs):len(ancs)], x)
+			default:
+				return
+			}
+
+			fn, _ := pkg.TypesInfo.Uses[id].(*types.Func)
+			if fn == nil || isInterfaceMethod(fn) {
+				return
+			}
+			if call, _ := callOf(id, ancs); call != nil {
+				return
+			}
+			sig, _ := pkg.TypeOf(expr).(*types.Signature)
+			if sig == nil {
+				return
+			}
+
+			g.values = append(g.values, funcValue{node: g.funcNode(fn), sig: sig})
+		})
+	}
+}
+
+// addLits adds nodes for the function literals in root, named after the
+// enclosing function named outer, and returns the number of literals named
+// so far, starting from count. Nested literals are named after the literal
+// containing them.
+func (g *CallGraph) addLits(pkg *Package, root ast.Node, outer string, count int) int {
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == root {
+			return true
+		}
+		lit, _ := n.(*ast.FuncLit)
+		if lit == nil {
+			return true
+		}
+
+		count++
+		ln := &CallNode{Lit: lit, Pkg: pkg, Name: fmt.Sprintf("%s$%d", outer, count), body: lit.Body}
+		g.lits[lit] = ln
+
+		if sig, _ := pkg.TypeOf(lit).(*types.Signature); sig != nil {
+			g.values = append(g.values, funcValue{node: ln, sig: sig})
+		}
+
+		g.addLits(pkg, lit, ln.Name, 0)
+		return false
+	})
+
+	return count
+}
+
+// addConcreteTypes records the named non-interface types declared in pkgs
+// and the packages they (transitively) import.
+func (g *CallGraph) addConcreteTypes(pkgs []*Package) {
+	for _, named := range namedTypes(pkgs, nil) {
+		if !types.IsInterface(named) {
+			g.concrete = append(g.concrete, named)
+		}
+	}
+}
+
+// addEdges adds the edges of the calls in pkg.
+func (g *CallGraph) addEdges(pkg *Package) {
+	for _, f := range pkg.BuildFiles() {
+		WalkAST(f, func(node ast.Node, ancs Ancestors) {
+			call, _ := node.(*ast.CallExpr)
+			if call == nil {
+				return
+			}
+
+			caller := g.callerOf(pkg, ancs)
+			for _, callee := range g.calleesOf(pkg, call) {
+				g.addEdge(&CallEdge{
+					Caller:  caller,
+					Callee:  callee.node,
+					Call:    call,
+					Pkg:     pkg,
+					Dynamic: callee.dynamic,
+				})
+			}
+		})
+	}
+}
+
+func (g *CallGraph) addEdge(e *CallEdge) {
+	// the same callee can be found through distinct copies of a type
+	for _, other := range e.Caller.Out {
+		if other.Call == e.Call && other.Callee == e.Callee {
+			return
+		}
+	}
+	e.Caller.Out = append(e.Caller.Out, e)
+	e.Callee.In = append(e.Callee.In, e)
+}
+
+// callerOf returns the node of the function containing the node with
+// ancestors ancs.
+func (g *CallGraph) callerOf(pkg *Package, ancs Ancestors) *CallNode {
+	for i := len(ancs) - 1; i >= 0; i-- {
+		switch a := ancs[i].(type) {
+		case *ast.FuncLit:
+			if n := g.lits[a]; n != nil {
+				return n
+			}
+		case *ast.FuncDecl:
+			if fn, _ := pkg.TypesInfo.Defs[a.Name].(*types.Func); fn != nil {
+				return g.funcNode(fn)
+			}
+		}
+	}
+	return g.initNode(pkg)
+}
+
+type callee struct {
+	node    *CallNode
+	dynamic bool
+}
+
+// calleesOf returns the possible callees of call, which is in pkg.
+func (g *CallGraph) calleesOf(pkg *Package, call *ast.CallExpr) []callee {
+	fun := ast.Unparen(call.Fun)
+
+	if lit, _ := fun.(*ast.FuncLit); lit != nil {
+		if n := g.lits[lit]; n != nil {
+			return []callee{{node: n}}
+		}
+		return nil
+	}
+
+	if tv, ok := pkg.TypesInfo.Types[fun]; ok && tv.IsType() {
+		// conversion
+		return nil
+	}
+
+	switch obj := typeutil.Callee(pkg.TypesInfo, call).(type) {
+	case *types.Builtin:
+		return nil
+	case *types.Func:
+		if !isInterfaceMethod(obj) {
+			return []callee{{node: g.funcNode(obj)}}
+		}
+
+		recv := obj.Type().(*types.Signature).Recv().Type()
+		if sel, _ := fun.(*ast.SelectorExpr); sel != nil {
+			if s := pkg.TypesInfo.Selections[sel]; s != nil && s.Kind() == types.MethodVal {
+				recv = s.Recv()
+			}
+		}
+		iface, _ := recv.Underlying().(*types.Interface)
+		if iface == nil {
+			return nil
+		}
+
+		var ret []callee
+		for _, m := range g.dispatch(iface, obj) {
+			ret = append(ret, callee{node: g.funcNode(m), dynamic: true})
+		}
+		return ret
+	}
+
+	typ := pkg.TypeOf(fun)
+	if typ == nil {
+		// fun did not type check
+		return nil
+	}
+	sig, _ := typ.Underlying().(*types.Signature)
+	if sig == nil {
+		return nil
+	}
+
+	var ret []callee
+	for _, n := range g.funcValues(sig) {
+		ret = append(ret, callee{node: n, dynamic: true})
+	}
+	return ret
+}
+
+// dispatch returns the concrete methods a call of method m of iface may
+// call, sorted by name.
+func (g *CallGraph) dispatch(iface *types.Interface, m *types.Func) []*types.Func {
+	impls, _ := g.implementers.At(iface).([]types.Type)
+	if impls == nil {
+		impls = []types.Type{}
+		for _, t := range g.concrete {
+			if types.Implements(t, iface) {
+				impls = append(impls, t)
+			} else if ptr := types.NewPointer(t); types.Implements(ptr, iface) {
+				impls = append(impls, ptr)
+			}
+		}
+		g.implementers.Set(iface, impls)
+	}
+
+	var ret []*types.Func
+	for _, t := range impls {
+		obj, _, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+		if fn, _ := obj.(*types.Func); fn != nil && !isInterfaceMethod(fn) {
+			ret = append(ret, fn)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].FullName() < ret[j].FullName()
+	})
+	return ret
+}
+
+// funcValues returns the nodes of the function values with signature sig.
+func (g *CallGraph) funcValues(sig *types.Signature) []*CallNode {
+	if cached, ok := g.valuesOfSig.At(sig).([]*CallNode); ok {
+		return cached
+	}
+
+	ret := []*CallNode{}
+	seen := make(map[*CallNode]bool)
+	for _, v := range g.values {
+		if !seen[v.node] && types.Identical(v.sig, sig) {
+			seen[v.node] = true
+			ret = append(ret, v.node)
+		}
+	}
+	g.valuesOfSig.Set(sig, ret)
+	return ret
+}
+
+// isInterfaceMethod returns whether fn is an abstract method of an
+// interface (or type parameter constraint).
+func isInterfaceMethod(fn *types.Func) bool {
+	sig, _ := fn.Type().(*types.Signature)
+	if sig == nil || sig.Recv() == nil {
+		return false
+	}
+	return types.IsInterface(sig.Recv().Type())
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCallGraph(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+import (
+	"bytes"
+	"io"
+)
+
+type DB struct{}
+
+func (*DB) Exec(query string) {}
+
+type Runner interface {
+	Run(db *DB)
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(db *DB) {
+	db.Exec("x")
+}
+
+type nopRunner struct{}
+
+func (*nopRunner) Run(*DB) {}
+
+func Handler(r Runner) {
+	r.Run(new(DB))
+}
+
+func Handler2(w io.Writer) {
+	w.Write(nil)
+
+	// unused has the same signature, but isn't used as a value
+	f := helper
+	if w == nil {
+		f = func(s string) {
+			new(DB).Exec(s)
+		}
+	}
+	f("y")
+}
+
+func helper(string) {}
+
+func unused(s string) {
+	helper(s)
+	func() {
+		_ = bytes.NewBuffer(nil)
+	}()
+}
+
+var initialized = compute()
+
+func compute() int { return 0 }
+`)
+
+	g := NewCallGraph(pkg)
+
+	names := func(edges []*CallEdge, callee bool) []string {
+		var ret []string
+		for _, e := range edges {
+			if callee {
+				ret = append(ret, e.Callee.Name)
+			} else {
+				ret = append(ret, e.Caller.Name)
+			}
+		}
+		sort.Strings(ret)
+		return ret
+	}
+
+	exec := pkg.LookupObject(pkg.Path() + ".DB.Exec")
+	if got := names(g.CallersOf(exec), false); !reflect.DeepEqual(got, []string{
+		"(" + pkg.Path() + ".execRunner).Run",
+		pkg.Path() + ".Handler2$1",
+	}) {
+		t.Errorf("got %q", got)
+	}
+
+	// interface method calls dispatch to all implementations, including
+	// those of imported packages
+	handler := pkg.LookupObject(pkg.Path() + ".Handler")
+	callees := g.CalleesOf(handler)
+	if got := names(callees, true); !reflect.DeepEqual(got, []string{
+		"(*" + pkg.Path() + ".nopRunner).Run",
+		"(" + pkg.Path() + ".execRunner).Run",
+	}) {
+		t.Errorf("got %q", got)
+	}
+	if !callees[0].Dynamic || pkg.Pos(callees[0].Call).Line != 28 {
+		t.Errorf("got %v", callees[0])
+	}
+
+	handler2 := pkg.LookupObject(pkg.Path() + ".Handler2")
+	var writers, values []string
+	for _, e := range g.CalleesOf(handler2) {
+		switch pkg.Pos(e.Call).Line {
+		case 32:
+			writers = append(writers, e.Callee.Name)
+		case 41:
+			values = append(values, e.Callee.Name)
+		}
+	}
+	if !contains(writers, "(*bytes.Buffer).Write") || !contains(writers, "(*io.PipeWriter).Write") {
+		t.Errorf("got %q", writers)
+	}
+	sort.Strings(values)
+	if !reflect.DeepEqual(values, []string{pkg.Path() + ".Handler2$1", pkg.Path() + ".helper"}) {
+		t.Errorf("got %q", values)
+	}
+
+	unused := pkg.LookupObject(pkg.Path() + ".unused")
+	if got := names(g.CalleesOf(unused), true); !reflect.DeepEqual(got, []string{pkg.Path() + ".helper", pkg.Path() + ".unused$1"}) {
+		t.Errorf("got %q", got)
+	}
+
+	compute := pkg.LookupObject(pkg.Path() + ".compute")
+	if got := names(g.CallersOf(compute), false); !reflect.DeepEqual(got, []string{pkg.Path() + ".init"}) {
+		t.Errorf("got %q", got)
+	}
+
+	path := g.Reachable(handler, exec)
+	if len(path) != 2 || path[0].Callee.Name != "("+pkg.Path()+".execRunner).Run" {
+		t.Errorf("got %v", path)
+	}
+	// through the function literal
+	if path := g.Reachable(handler2, exec); len(path) != 2 || path[0].Callee.Name != pkg.Path()+".Handler2$1" {
+		t.Errorf("got %v", path)
+	}
+	if path := g.Reachable(unused, exec); path != nil {
+		t.Errorf("got %v", path)
+	}
+
+	if g.Node(types.Universe.Lookup("error").Type().Underlying().(*types.Interface).Method(0)) != nil {
+		t.Error("expected no node for error.Error")
+	}
+}
+
+// loadSeparately loads example.com/sep/a and example.com/sep/b, which
+// imports a, in separate calls of one Loader, in the order of paths. Loading
+// b first leaves the Loader with two copies of a: the one b imports and the
+// one loaded directly.
+func loadSeparately(t *testing.T, paths ...string) (a, b *Package) {
+	dir := writeModule(t, "example.com/sep", map[string]string{
+		"a/a.go": `package a
+
+type Arg struct{}
+
+type T struct{}
+
+func (T) M(Arg) {}
+
+var V = 1
+`,
+		"b/b.go": `package b
+
+import "example.com/sep/a"
+
+type I interface {
+	M(a.Arg)
+}
+
+func Call(i I) {
+	i.M(a.Arg{})
+}
+
+func Use() {
+	Call(a.T{})
+	_ = a.V
+}
+`,
+	})
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+
+	for _, path := range paths {
+		pkg := l.Pkgs(path)[0]
+		if path == "example.com/sep/a" {
+			a = pkg
+		} else {
+			b = pkg
+		}
+	}
+	return a, b
+}
+
+func TestCallGraphSeparateLoads(t *testing.T) {
+	for _, order := range [][]string{
+		{"example.com/sep/b", "example.com/sep/a"},
+		{"example.com/sep/a", "example.com/sep/b"},
+	} {
+		a, b := loadSeparately(t, order...)
+		call := b.TypesPkg.Scope().Lookup("Call")
+		for _, g := range []*CallGraph{NewCallGraph(a, b), NewCallGraph(b, a)} {
+			var callees []string
+			for _, e := range g.CalleesOf(call) {
+				callees = append(callees, e.Callee.Name)
+			}
+			if !reflect.DeepEqual(callees, []string{"(example.com/sep/a.T).M"}) {
+				t.Errorf("%v: got %v", order, callees)
+			}
+		}
+
+		iface := b.TypesPkg.Scope().Lookup("I").Type()
+		for _, pkg := range []*Package{a, b} {
+			if impls := pkg.ImplementationsOf(iface); len(impls) != 1 || impls[0].String() != "example.com/sep/a.T" {
+				t.Errorf("%v: got %v", order, impls)
+			}
+		}
+		if ifaces := b.InterfacesSatisfiedBy(a.TypesPkg.Scope().Lookup("T").Type()); len(ifaces) != 1 || ifaces[0].String() != "example.com/sep/b.I" {
+			t.Errorf("%v: got %v", order, ifaces)
+		}
+	}
+}
+
+func TestCallGraphTypeErrors(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "broken.go", `package broken
+
+func Call() {
+	undefined()
+	missing.Func()
+}
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := newTypesInfo()
+	conf := types.Config{Error: func(error) {}}
+	tPkg, _ := conf.Check("broken", fset, []*ast.File{f}, info)
+
+	pkg := defaultLoader.newPackage(&ast.Package{Name: "broken", Files: map[string]*ast.File{"broken.go": f}}, fset, info, tPkg)
+	pkg.buildFiles = []*ast.File{f}
+
+	g := NewCallGraph(pkg)
+	if edges := g.CalleesOf(tPkg.Scope().Lookup("Call")); len(edges) != 0 {
+		t.Errorf("got %v", edges)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
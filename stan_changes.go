@@ -0,0 +1,289 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Changes are the lines added or modified by a unified diff, such as the
+// output of "git diff", for reporting only diagnostics on changed code:
+//
+//	changes, err := stan.ReadChanges("-") // git diff origin/master | ...
+//	diags = changes.Filter(diags)
+//
+// Only the diff text is used; there is no need for a VCS.
+type Changes struct {
+	// Directory the paths in the diff are relative to; defaults to the
+	// repository root of the working directory, see RepoRoot().
+	Root string
+
+	// new file name (slash separated, as in the diff) => changed lines
+	files map[string][]lineRange
+}
+
+// lineRange is the lines [start, end].
+type lineRange struct {
+	start, end int
+}
+
+// ReadChanges() parses the unified diff in filename, or stdin if filename is
+// "-".
+func ReadChanges(filename string) (*Changes, error) {
+	if filename == "-" {
+		return ParseChanges(os.Stdin)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseChanges(f)
+}
+
+// ParseChanges() parses a unified diff. Diffs with and without "a/" and
+// "b/" prefixes are understood. Deleted files and lines are ignored since
+// diagnostics can't point at them.
+func ParseChanges(r io.Reader) (*Changes, error) {
+	c := &Changes{files: make(map[string][]lineRange)}
+
+	var (
+		oldName string
+		newName string
+		oldLeft int // lines of the current hunk left to read
+		newLeft int
+		newLine int
+		lineNum int
+		scanner = bufio.NewScanner(r)
+		errorf  = func(format string, args ...interface{}) error {
+			return fmt.Errorf("diff line %d: %s", lineNum, fmt.Sprintf(format, args...))
+		}
+	)
+	scanner.Buffer(nil, 1<<24)
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				c.add(newName, newLine, newLine)
+				newLine++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, " "), line == "":
+				newLine++
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				return nil, errorf("unexpected %q in hunk", line)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			oldName = diffFileName(line[len("--- "):])
+		case strings.HasPrefix(line, "+++ "):
+			newName = diffFileName(line[len("+++ "):])
+			if newName != "" && strings.HasPrefix(newName, "b/") && (oldName == "" || strings.HasPrefix(oldName, "a/")) {
+				newName = newName[len("b/"):]
+			}
+		case strings.HasPrefix(line, "@@ "):
+			var err error
+			_, oldLeft, newLine, newLeft, err = parseHunkHeader(line)
+			if err != nil {
+				return nil, errorf("%s", err)
+			}
+			if newName == "" && newLeft > 0 {
+				return nil, errorf("hunk adds lines to a deleted file")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, errorf("truncated hunk")
+	}
+
+	return c, nil
+}
+
+// diffFileName returns the file name of a "---" or "+++" line, or "" for
+// /dev/null.
+func diffFileName(s string) string {
+	// other diffs append a tab and a timestamp; git quotes unusual names,
+	// escaping tabs
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, `"`) {
+		if name, err := strconv.Unquote(s); err == nil {
+			s = name
+		}
+	}
+
+	if s == "/dev/null" {
+		return ""
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -oldStart,oldLines +newStart,newLines @@".
+// The line counts default to 1 when omitted.
+func parseHunkHeader(line string) (oldStart, oldLines, newStart, newLines int, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, 0, fmt.Errorf("malformed hunk header %q", line)
+	}
+
+	parse := func(s string) (start, lines int, err error) {
+		lines = 1
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+				return 0, 0, fmt.Errorf("malformed hunk header %q", line)
+			}
+			s = s[:i]
+		}
+		if start, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("malformed hunk header %q", line)
+		}
+		return start, lines, nil
+	}
+
+	if oldStart, oldLines, err = parse(fields[1][1:]); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if newStart, newLines, err = parse(fields[2][1:]); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return oldStart, oldLines, newStart, newLines, nil
+}
+
+// add marks lines [start, end] of name as changed, merging adjacent ranges.
+func (c *Changes) add(name string, start, end int) {
+	ranges := c.files[name]
+	ranges = append(ranges, lineRange{start, end})
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end+1 {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	c.files[name] = merged
+}
+
+// Files() returns the names of the changed files as they appear in the diff,
+// sorted.
+func (c *Changes) Files() []string {
+	var ret []string
+	for name := range c.files {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (c *Changes) root() string {
+	if c.Root != "" {
+		return c.Root
+	}
+	return RepoRoot(".")
+}
+
+// ranges returns the changed lines of filename, which is either absolute or
+// relative to c's root.
+func (c *Changes) ranges(root, filename string) []lineRange {
+	return c.files[path.Clean(relPath(root, filename))]
+}
+
+// Contains() returns whether pos is on a changed line.
+func (c *Changes) Contains(pos token.Position) bool {
+	return overlaps(c.ranges(c.root(), pos.Filename), pos.Line, pos.Line)
+}
+
+// overlaps returns whether any of ranges intersects lines [start, end].
+func overlaps(ranges []lineRange, start, end int) bool {
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i].end >= start
+	})
+	return i < len(ranges) && ranges[i].start <= end
+}
+
+// Filter() returns the diagnostics on changed lines. Diagnostics spanning
+// several lines are kept if any of them changed.
+func (c *Changes) Filter(diags []Diagnostic) []Diagnostic {
+	root := c.root()
+
+	var ret []Diagnostic
+	for _, d := range diags {
+		end := d.Pos.Line
+		if d.End.IsValid() && d.End.Filename == d.Pos.Filename && d.End.Line > end {
+			end = d.End.Line
+		}
+
+		if overlaps(c.ranges(root, d.Pos.Filename), d.Pos.Line, end) {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// Widen() returns a copy of c where changes inside a function of pkgs mark
+// the whole function as changed, to also report problems that a change
+// causes elsewhere in the function (e.g. a variable no longer being used).
+func (c *Changes) Widen(pkgs ...*Package) *Changes {
+	ret := &Changes{Root: c.Root, files: make(map[string][]lineRange)}
+	for name, ranges := range c.files {
+		ret.files[name] = append([]lineRange(nil), ranges...)
+	}
+
+	root := c.root()
+	for _, pkg := range pkgs {
+		for filename, f := range pkg.Files() {
+			ranges := c.ranges(root, filename)
+			if len(ranges) == 0 {
+				continue
+			}
+			name := path.Clean(relPath(root, filename))
+
+			for _, decl := range f.Decls {
+				fn, _ := decl.(*ast.FuncDecl)
+				if fn == nil {
+					continue
+				}
+
+				start, end := pkg.Pos(fn).Line, pkg.Fset.Position(fn.End()).Line
+				if overlaps(ranges, start, end) {
+					ret.add(name, start, end)
+				}
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const changesDiff = `diff --git a/foo/foo.go b/foo/foo.go
+index 1111111..2222222 100644
+--- a/foo/foo.go
++++ b/foo/foo.go
+@@ -3,6 +3,7 @@ package foo
+ import "time"
+ 
+ func f() {
+-	a := 1
++	a := 2
++	b := 3
+ 
+ 	_ = a
+@@ -20,3 +21,3 @@ func g() {
+ 	x()
+-	y()
++	z()
+ }
+\ No newline at end of file
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package foo
+-
+--- /dev/null
++++ "new file.go"	2018-01-02 03:04:05
+@@ -0,0 +1,2 @@
++package foo
++
+`
+
+func TestParseChanges(t *testing.T) {
+	c, err := ParseChanges(strings.NewReader(changesDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.Files(); !reflect.DeepEqual(got, []string{"foo/foo.go", "new file.go"}) {
+		t.Errorf("got %q", got)
+	}
+
+	expected := map[string][]lineRange{
+		"foo/foo.go":  {{6, 7}, {22, 22}},
+		"new file.go": {{1, 2}},
+	}
+	if !reflect.DeepEqual(c.files, expected) {
+		t.Errorf("got %v", c.files)
+	}
+
+	for _, bad := range []string{
+		"--- a/x\n+++ b/x\n@@ -1 +1 @@\n",
+		"--- a/x\n+++ b/x\n@@ -1 +1 @@\n*oops\n",
+		"--- a/x\n+++ b/x\n@@ -1,x +1 @@\n",
+	} {
+		if _, err := ParseChanges(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestChangesFilter(t *testing.T) {
+	c, err := ParseChanges(strings.NewReader(changesDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Root = filepath.FromSlash("/src/repo")
+
+	pos := func(file string, line int) token.Position {
+		return token.Position{Filename: filepath.FromSlash(file), Line: line, Column: 1}
+	}
+
+	if !c.Contains(pos("/src/repo/foo/foo.go", 7)) || c.Contains(pos("/src/repo/foo/foo.go", 8)) || c.Contains(pos("/src/other/foo/foo.go", 7)) {
+		t.Error("unexpected Contains()")
+	}
+
+	diags := c.Filter([]Diagnostic{
+		{Pos: pos("/src/repo/foo/foo.go", 5), Message: "before"},
+		{Pos: pos("/src/repo/foo/foo.go", 6), Message: "changed"},
+		{Pos: pos("/src/repo/foo/foo.go", 4), End: pos("/src/repo/foo/foo.go", 9), Message: "spanning"},
+		{Pos: pos("/src/repo/foo/foo.go", 21), Message: "unchanged"},
+		{Pos: pos("/src/repo/new file.go", 1), Message: "new"},
+		{Pos: pos("/src/repo/bar.go", 6), Message: "other file"},
+	})
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.Message)
+	}
+	if !reflect.DeepEqual(got, []string{"changed", "spanning", "new"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestChangesWiden(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+func f() {
+	badOne := 1
+	_ = badOne
+}
+
+func g() {
+	badTwo := 2
+	_ = badTwo
+}
+
+var badThree = 3
+`)
+
+	var filename string
+	for name := range pkg.Files() {
+		filename = name
+	}
+
+	base := filepath.Base(filename)
+	diff := "--- a/" + base + "\n+++ b/" + base + "\n@@ -6 +6 @@\n-\t_ = badOne // TODO\n+\t_ = badOne\n"
+	c, err := ParseChanges(strings.NewReader(diff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Root = filepath.Dir(filename)
+
+	diags := noBadCheck.Diagnose(pkg)
+	if got := c.Filter(diags); len(got) != 1 || got[0].Pos.Line != 6 {
+		t.Errorf("got %v", got)
+	}
+
+	if got := c.Widen(pkg).Filter(diags); len(got) != 2 || got[0].Pos.Line != 5 || got[1].Pos.Line != 6 {
+		t.Errorf("got %v", got)
+	}
+
+	// c itself is unchanged
+	if got := c.Filter(diags); len(got) != 1 {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Check is a named static analysis check.
+//
+//	var TimeEqual = &stan.Check{
+//	  Name: "timeequal",
+//	  Doc:  "don't compare time.Time values with ==",
+//	  Func: func(pkg *stan.Package, r stan.Reporter) {
+//	    ...
+//	    r.Reportf(binary, "use Equal() to compare time.Time values")
+//	  },
+//	}
+type Check struct {
+	// Short, unique name used in diagnostics and //stan:ignore comments
+	Name string
+	// Description of what the check looks for
+	Doc string
+	// Func inspects pkg and reports problems to r
+	Func func(pkg *Package, r Reporter)
+
+	analyzerOnce sync.Once
+	analyzer     *analysis.Analyzer
+}
+
+func (c *Check) String() string {
+	return c.Name
+}
+
+// Diagnose() runs c on pkg and returns the diagnostics it reports, without
+// applying //stan:ignore suppressions. Use it with ExpectDiagnostics():
+//
+//	stan.ExpectDiagnostics(t, TimeEqual.Diagnose, code)
+func (c *Check) Diagnose(pkg *Package) []Diagnostic {
+	r := &diagnostics{pkg: pkg, check: c.Name}
+	c.Func(pkg, r)
+	return r.diags
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Check)
+)
+
+// Register() adds checks to the registry, making them available to Run()
+// and Checks(). Register() panics if a check has no name, or the name is
+// registered already.
+func Register(checks ...*Check) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, c := range checks {
+		if c.Name == "" {
+			panic("check has no name")
+		}
+		if registry[c.Name] != nil {
+			panic(fmt.Sprintf("check %q registered twice", c.Name))
+		}
+		registry[c.Name] = c
+	}
+}
+
+// Checks() returns the registered checks ordered by name.
+func Checks() []*Check {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	ret := make([]*Check, 0, len(registry))
+	for _, c := range registry {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// unregister removes the checks called names from the registry.
+func unregister(names ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, name := range names {
+		delete(registry, name)
+	}
+}
+
+// LookupCheck() returns the registered check called name, or nil.
+func LookupCheck(name string) *Check {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	return registry[name]
+}
+
+// RunChecks() runs checks on pkg and returns their diagnostics after
+// applying pkg's //stan:ignore suppressions, followed by diagnostics for
+// suppressions of checks that didn't suppress anything.
+func RunChecks(pkg *Package, checks ...*Check) []Diagnostic {
+	return runChecks(pkg, checks, true)
+}
+
+// runChecks is RunChecks(), reporting suppressions without a check name only
+// if nameless is set.
+func runChecks(pkg *Package, checks []*Check, nameless bool) []Diagnostic {
+	var (
+		diags []Diagnostic
+		names []string
+	)
+	for _, c := range checks {
+		diags = append(diags, c.Diagnose(pkg)...)
+		names = append(names, c.Name)
+	}
+
+	kept, unused := pkg.suppress(diags, nameless, names...)
+	return append(kept, unused...)
+}
+
+// Run() loads the packages matching patterns once, then runs each check on
+// each package in a subtest named "<check>/<package>". Diagnostics of
+// severity error fail the subtest; others are logged. Packages that fail to
+// load fail the test, but the packages that did load are still checked. Run()
+// uses all registered checks if none are given.
+//
+//	func TestStaticChecks(t *testing.T) {
+//	  stan.Run(t, []string{"your/namespace/..."}, TimeEqual, CSVWriterError)
+//	}
+func Run(t *testing.T, patterns []string, checks ...*Check) {
+	t.Helper()
+
+	if len(checks) == 0 {
+		checks = Checks()
+	}
+
+	// report packages that failed to load, but still check the others
+	pkgs, err := LoadPkgs(patterns...)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i, c := range checks {
+		c := c
+		// suppressions without a check name are reported with the first
+		// check only
+		nameless := i == 0
+		t.Run(c.Name, func(t *testing.T) {
+			for _, pkg := range pkgs {
+				pkg := pkg
+				t.Run(pkg.Path(), func(t *testing.T) {
+					for _, d := range runChecks(pkg, []*Check{c}, nameless) {
+						if d.Severity == SeverityError {
+							t.Error(d)
+						} else {
+							t.Logf("%s: %s", d.Severity, d)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+)
+
+var noBadCheck = &Check{
+	Name: "nobad",
+	Doc:  "don't name things bad",
+	Func: func(pkg *Package, r Reporter) {
+		for _, f := range pkg.Files() {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if id, _ := n.(*ast.Ident); id != nil && strings.HasPrefix(id.Name, "bad") {
+					r.Reportf(id, "don't name things %s", id.Name)
+				}
+				return true
+			})
+		}
+	},
+}
+
+func TestCheck(t *testing.T) {
+	ExpectDiagnostics(t, noBadCheck.Diagnose, `
+package fake
+
+var badOne = 1 // want "don't name things badOne"
+`)
+
+	pkg := EvalPkg(`
+package fake
+
+var badOne = 1
+
+var badTwo = 2 //stan:ignore nobad testing
+
+//stan:ignore nobad unused
+var good = 3
+`)
+
+	diags := noBadCheck.Diagnose(pkg)
+	if len(diags) != 2 {
+		t.Fatalf("got %v", diags)
+	}
+	if d := diags[0]; d.Check != "nobad" || d.Severity != SeverityError || d.Pos.Line != 4 || d.End.Column != d.Pos.Column+len("badOne") {
+		t.Errorf("got %+v", d)
+	}
+
+	diags = RunChecks(pkg, noBadCheck)
+	if len(diags) != 2 || diags[0].Message != "don't name things badOne" || diags[1].Check != "stan:ignore" {
+		t.Errorf("got %v", diags)
+	}
+
+	// Run() and RunWithBaseline() report suppressions without a check name
+	// with one check only
+	pkg = EvalPkg(`
+package fake
+
+//stan:ignore
+var good = 1
+`)
+	if diags := runChecks(pkg, []*Check{noBadCheck}, true); len(diags) != 1 || diags[0].Message != "suppression does not name a check" {
+		t.Errorf("got %v", diags)
+	}
+	if diags := runChecks(pkg, []*Check{noBadCheck}, false); len(diags) != 0 {
+		t.Errorf("got %v", diags)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a, b := &Check{Name: "registry_b"}, &Check{Name: "registry_a"}
+	Register(a, b)
+	// keep the checks away from Run() and Main() in other tests
+	t.Cleanup(func() {
+		unregister(a.Name, b.Name)
+	})
+
+	if LookupCheck("registry_a") != b {
+		t.Error("lookup failed")
+	}
+
+	var names []string
+	for _, c := range Checks() {
+		if strings.HasPrefix(c.Name, "registry_") {
+			names = append(names, c.Name)
+		}
+	}
+	if strings.Join(names, ",") != "registry_a,registry_b" {
+		t.Errorf("got %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	Register(&Check{Name: "registry_a"})
+}
+
+func TestRun(t *testing.T) {
+	var ran []string
+
+	Run(t, []string{"github.com/retailnext/stan/internal/generic/..."}, noBadCheck, &Check{
+		Name: "warner",
+		Func: func(pkg *Package, r Reporter) {
+			ran = append(ran, pkg.Path())
+			for _, f := range pkg.Files() {
+				r.Report(Diagnostic{
+					Pos:      pkg.Pos(f.Name),
+					Severity: SeverityWarning,
+					Message:  "just a warning",
+				})
+			}
+		},
+	})
+
+	if strings.Join(ran, ",") != "github.com/retailnext/stan/internal/generic,github.com/retailnext/stan/internal/generic/user" {
+		t.Errorf("got %v", ran)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Directive is a "//prefix:name args" comment, such as "//go:generate ..." or
+// "//nolint:errcheck".
+type Directive struct {
+	// Part before the colon, e.g. "go"
+	Prefix string
+	// Part after the colon up to the first space, e.g. "generate"
+	Name string
+	// Rest of the comment with surrounding space trimmed
+	Args string
+	// The directive's comment
+	Comment *ast.Comment
+}
+
+// Pos() returns the position of d's comment, so d can be passed to
+// Package.Pos().
+func (d Directive) Pos() token.Pos {
+	return d.Comment.Pos()
+}
+
+// String() returns d as it appears in the source.
+func (d Directive) String() string {
+	return d.Comment.Text
+}
+
+// Directives() returns the directives among the comments of f, one of p's
+// files, in source order. Like the go command, Directives() only considers
+// line comments with no space after "//", a prefix of lower case letters and
+// digits, and a name starting with one.
+func (p *Package) Directives(f *ast.File) []Directive {
+	var ret []Directive
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			if d, ok := parseDirective(c); ok {
+				ret = append(ret, d)
+			}
+		}
+	}
+	return ret
+}
+
+func parseDirective(c *ast.Comment) (Directive, bool) {
+	if !strings.HasPrefix(c.Text, "//") {
+		return Directive{}, false
+	}
+	text := c.Text[2:]
+
+	colon := strings.Index(text, ":")
+	if colon <= 0 {
+		return Directive{}, false
+	}
+	for _, r := range text[:colon] {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9') {
+			return Directive{}, false
+		}
+	}
+
+	rest := text[colon+1:]
+	if rest == "" || !('a' <= rest[0] && rest[0] <= 'z' || '0' <= rest[0] && rest[0] <= '9') {
+		return Directive{}, false
+	}
+
+	name, args := rest, ""
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		name, args = rest[:i], strings.TrimSpace(rest[i:])
+	}
+
+	return Directive{
+		Prefix:  text[:colon],
+		Name:    name,
+		Args:    args,
+		Comment: c,
+	}, true
+}
+
+// CommentsFor() returns the comment groups associated with node, as
+// determined by ast.NewCommentMap(). Doc comments, trailing line comments and
+// free-standing comments preceding node are all included.
+func (p *Package) CommentsFor(node ast.Node) []*ast.CommentGroup {
+	f := p.fileOf(node.Pos())
+	if f == nil {
+		return nil
+	}
+
+	return p.commentMap(f)[node]
+}
+
+func (p *Package) commentMap(f *ast.File) ast.CommentMap {
+	if p.commentMaps == nil {
+		p.commentMaps = make(map[*ast.File]ast.CommentMap)
+	}
+
+	cmap, found := p.commentMaps[f]
+	if !found {
+		cmap = ast.NewCommentMap(p.Fset, f, f.Comments)
+		p.commentMaps[f] = cmap
+	}
+
+	return cmap
+}
+
+// DocOf() returns the doc comment of obj's declaration, or nil if it has
+// none. obj can be declared in another package, which is loaded as with
+// DeclOf().
+func (p *Package) DocOf(obj types.Object) *ast.CommentGroup {
+	if obj == nil || obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return nil
+	}
+
+	_, _, ancs := p.DeclOf(obj)
+
+	switch decl := ancs.Pop().(type) {
+	case *ast.FuncDecl:
+		return decl.Doc
+	case *ast.Field:
+		return decl.Doc
+	case *ast.ImportSpec:
+		return decl.Doc
+	case *ast.TypeSpec:
+		if decl.Doc != nil {
+			return decl.Doc
+		}
+	case *ast.ValueSpec:
+		if decl.Doc != nil {
+			return decl.Doc
+		}
+	default:
+		return nil
+	}
+
+	// a lone, unparenthesized spec is documented by its GenDecl
+	if gen, _ := ancs.Peek().(*ast.GenDecl); gen != nil && !gen.Lparen.IsValid() {
+		return gen.Doc
+	}
+
+	return nil
+}
+
+// fileOf returns p's *ast.File containing pos, or nil.
+func (p *Package) fileOf(pos token.Pos) *ast.File {
+	tf := p.Fset.File(pos)
+	if tf == nil {
+		return nil
+	}
+	return p.Node.Files[tf.Name()]
+}
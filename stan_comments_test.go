@@ -0,0 +1,104 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+//go:generate stringer -type=T
+
+// T is documented.
+type T int
+
+type (
+	// U is documented within parens.
+	U int
+	V int // V has a line comment.
+)
+
+// unused
+var (
+	noDoc int
+)
+
+// f is documented.
+//
+//nolint:unused // reason
+func f() {
+	// hello
+	_ = noDoc // there
+}
+
+type S struct {
+	// Field is documented.
+	Field int
+}
+
+//go:noinline
+func g() {}
+
+// not a directive
+// notone: either
+//Not:upper
+`)
+
+	docs := map[string]string{
+		".T":       "T is documented.\n",
+		".U":       "U is documented within parens.\n",
+		".V":       "",
+		".noDoc":   "",
+		".f":       "f is documented.\n",
+		".S.Field": "Field is documented.\n",
+	}
+	for name, expected := range docs {
+		doc := pkg.DocOf(pkg.LookupObject(pkg.Path() + name))
+		if got := doc.Text(); got != expected {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+
+	if doc := pkg.DocOf(pkg.LookupObject("fmt.Println")); doc == nil {
+		t.Error("expected doc of fmt.Println")
+	}
+
+	var file *ast.File
+	for _, f := range pkg.Files() {
+		file = f
+	}
+
+	var got [][3]string
+	for _, d := range pkg.Directives(file) {
+		got = append(got, [3]string{d.Prefix, d.Name, d.Args})
+		if pkg.Pos(d).Line == 0 {
+			t.Errorf("no position for %s", d)
+		}
+	}
+	expected := [][3]string{
+		{"go", "generate", "stringer -type=T"},
+		{"nolint", "unused", "// reason"},
+		{"go", "noinline", ""},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v", got)
+	}
+
+	var texts []string
+	for _, decl := range file.Decls {
+		if fn, _ := decl.(*ast.FuncDecl); fn != nil && fn.Name.Name == "f" {
+			for _, group := range pkg.CommentsFor(fn.Body.List[0]) {
+				texts = append(texts, group.Text())
+			}
+		}
+	}
+	if !reflect.DeepEqual(texts, []string{"hello\n", "there\n"}) {
+		t.Errorf("got %q", texts)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/token"
+)
+
+// Diagnostic is a problem found by a check.
+type Diagnostic struct {
+	// Position of the problem
+	Pos token.Position
+	// End of the problematic code, if known. Use End.IsValid() to check.
+	End token.Position
+	// Name of the check that found the problem
+	Check string
+	// How bad the problem is; the zero value is SeverityError
+	Severity Severity
+	// Human readable description of the problem
+	Message string
+	// Other positions relevant to the problem, such as a conflicting
+	// declaration
+	Related []RelatedInformation
+	// Mechanical fixes for the problem, best first. See ApplyFixes().
+	SuggestedFixes []SuggestedFix
+}
+
+// RelatedInformation is a position related to a Diagnostic.
+type RelatedInformation struct {
+	Pos     token.Position
+	Message string
+}
+
+// String() returns d as "file:line:column: message (check)".
+func (d Diagnostic) String() string {
+	if d.Check == "" {
+		return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Check)
+}
+
+// Severity is how bad a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+// String() returns "error", "warning" or "info".
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Reporter receives the diagnostics of a check.
+type Reporter interface {
+	// Report() records d. d.Check defaults to the reporting check's name.
+	Report(d Diagnostic)
+	// Reportf() records an error at n with a formatted message. If n is an
+	// ast.Node, its end is recorded too.
+	Reportf(n Poser, format string, args ...interface{})
+}
+
+// diagnostics is the Reporter collecting a check's diagnostics for pkg.
+type diagnostics struct {
+	pkg   *Package
+	check string
+	diags []Diagnostic
+}
+
+func (r *diagnostics) Report(d Diagnostic) {
+	if d.Check == "" {
+		d.Check = r.check
+	}
+	r.diags = append(r.diags, d)
+}
+
+func (r *diagnostics) Reportf(n Poser, format string, args ...interface{}) {
+	d := Diagnostic{
+		Pos:     r.pkg.Pos(n),
+		Message: fmt.Sprintf(format, args...),
+	}
+	if ender, ok := n.(interface{ End() token.Pos }); ok && ender.End().IsValid() {
+		d.End = r.pkg.Fset.Position(ender.End())
+	}
+	r.Report(d)
+}
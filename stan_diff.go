@@ -0,0 +1,220 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// lines of context around changes in unified diffs
+const diffContext = 3
+
+// above this many cells, don't bother computing a minimal diff of the
+// changed region
+const maxDiffCells = 4 << 20
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff writes a unified diff from a to b, labelled with name, to w.
+// Relative names get the usual "a/" and "b/" prefixes, absolute names are
+// used as is. Nothing is written if a and b are equal.
+func unifiedDiff(w io.Writer, name string, a, b []byte) error {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	aName, bName := "a/"+name, "b/"+name
+	if path.IsAbs(name) || filepath.IsAbs(name) {
+		aName, bName = name, name
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+
+	var (
+		aLine, bLine = 1, 1
+		lastEnd      int
+		changed      bool
+	)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		changed = true
+
+		// leading context, not overlapping the previous hunk
+		leading := i - lastEnd
+		if leading > diffContext {
+			leading = diffContext
+		}
+		start := i - leading
+
+		// extend the hunk over changes separated by less than twice the
+		// context, then add trailing context
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > 2*diffContext {
+				if run > diffContext {
+					run = diffContext
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+
+		var aCount, bCount int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(aLine-leading, aCount), hunkRange(bLine-leading, bCount))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, op := range ops[i:end] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		i, lastEnd = end, end
+	}
+
+	if !changed {
+		return nil
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// empty ranges are named by the line before them
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits b after each newline.
+func splitLines(b []byte) []string {
+	var ret []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			ret = append(ret, string(b))
+			break
+		}
+		ret = append(ret, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return ret
+}
+
+// diffLines returns an edit script turning a into b. Common leading and
+// trailing lines are trimmed and the rest is diffed using the longest common
+// subsequence.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		for _, l := range midA {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range midB {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
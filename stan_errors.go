@@ -0,0 +1,57 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"errors"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+var errNoSuchPackage = errors.New("no such package")
+
+// PackageError describes why a single package could not be loaded.
+type PackageError struct {
+	// Import path (or pattern) of the package that failed to load.
+	Path string
+	// Position of the problem, if known. Use Pos.IsValid() to check.
+	Pos token.Position
+	// Underlying cause, such as a scanner.ErrorList or types.Error.
+	Err error
+}
+
+func (e *PackageError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func newPackageError(path string, err error) *PackageError {
+	pe := &PackageError{Path: path, Err: err}
+
+	switch v := err.(type) {
+	case scanner.ErrorList:
+		if len(v) > 0 {
+			pe.Pos = v[0].Pos
+		}
+	case *scanner.Error:
+		pe.Pos = v.Pos
+	case types.Error:
+		pe.Pos = v.Fset.Position(v.Pos)
+	}
+
+	return pe
+}
+
+// LoadErrors is the error returned by LoadPkgs(). It lists a *PackageError for
+// each package that failed to load.
+type LoadErrors []*PackageError
+
+func (e LoadErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPkgsErrors(t *testing.T) {
+	pkgs, err := LoadPkgs("./testdata/broken/...")
+
+	if len(pkgs) != 1 || !strings.HasSuffix(pkgs[0].Path(), "testdata/broken/ok") {
+		t.Errorf("got %v", pkgs)
+	}
+
+	errs, ok := err.(LoadErrors)
+	if !ok {
+		t.Fatalf("got %T (%v)", err, err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("got %v", errs)
+	}
+
+	expected := map[string]int{
+		"syntaxerr.go": 3,
+		"typeerr.go":   3,
+	}
+
+	for _, pe := range errs {
+		base := filepath.Base(pe.Pos.Filename)
+		line, found := expected[base]
+		if !found {
+			t.Errorf("unexpected error %s", pe)
+			continue
+		}
+		if pe.Pos.Line != line {
+			t.Errorf("got line %d for %s", pe.Pos.Line, pe)
+		}
+		if !strings.HasSuffix(pe.Path, strings.TrimSuffix(base, ".go")) {
+			t.Errorf("got path %s for %s", pe.Path, base)
+		}
+		delete(expected, base)
+	}
+
+	// failed packages are reported again rather than cached
+	if _, err := LoadPkgs("./testdata/broken/..."); err == nil {
+		t.Error("expected error on second load")
+	}
+
+	if _, err := LoadPkgs("github.com/retailnext/stan/internal/nonexistent"); err == nil {
+		t.Error("expected error for missing package")
+	}
+}
+
+func TestTryLookup(t *testing.T) {
+	foo := Pkgs("github.com/retailnext/stan/internal/foo")[0]
+
+	if _, err := foo.TryLookupType("github.com/retailnext/stan/internal/foo.NoSuchType"); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := foo.TryLookupObject("github.com/retailnext/stan/internal/nonexistent.Thing"); err == nil {
+		t.Error("expected error")
+	}
+
+	if obj, err := foo.TryLookupObject("github.com/retailnext/stan/internal/foo.FooFunc"); err != nil || obj == nil {
+		t.Errorf("got %v, %v", obj, err)
+	}
+
+	if _, err := TryEvalPkg("package fake\n\nvar x int = \"\""); err == nil {
+		t.Error("expected error")
+	}
+}
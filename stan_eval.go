@@ -6,9 +6,12 @@ package stan
 import (
 	"fmt"
 	"go/token"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // EvalPkg() parses and type checks code into a *Package. EvalPkg() is useful
@@ -16,27 +19,54 @@ import (
 // code was run from os.Getwd(). EvalPkg() panics if there is an error parsing
 // or type checking code.
 func EvalPkg(code string) *Package {
+	return defaultLoader.EvalPkg(code)
+}
+
+// TryEvalPkg() is like EvalPkg(), but returns an error instead of panicking.
+// Parse and type check errors are returned as a *PackageError.
+func TryEvalPkg(code string) (*Package, error) {
+	return defaultLoader.TryEvalPkg(code)
+}
+
+// EvalPkg() is like the package level EvalPkg(), but imports packages using
+// l's build configuration and caches. Vendor imports operate as if the code
+// was run from l.Dir.
+func (l *Loader) EvalPkg(code string) *Package {
+	pkg, err := l.TryEvalPkg(code)
+	if err != nil {
+		panic(err.Error())
+	}
+	return pkg
+}
+
+// TryEvalPkg() is like EvalPkg(), but returns an error instead of panicking.
+func (l *Loader) TryEvalPkg(code string) (*Package, error) {
+	l.init()
+
 	tmpDir, err := ioutil.TempDir("", "stan_fake_package")
 	if err != nil {
-		panic(fmt.Sprintf("error making temp dir: %s", err))
+		return nil, fmt.Errorf("error making temp dir: %s", err)
 	}
 
 	defer os.RemoveAll(tmpDir)
 
 	err = ioutil.WriteFile(filepath.Join(tmpDir, "fake_package.go"), []byte(code), 0644)
 	if err != nil {
-		panic(fmt.Sprintf("error writing fake_package.go: %s", err))
+		return nil, fmt.Errorf("error writing fake_package.go: %s", err)
 	}
 
-	parsed, err := parseDir(tmpDir, token.NewFileSet())
+	parsed, err := l.parseDir(tmpDir, token.NewFileSet())
 	if err != nil {
-		panic(fmt.Sprintf("error parsing fake package: %s", err))
+		return nil, newPackageError("fake package", err)
 	}
 
 	pkg := parsed.code
 	if pkg == nil {
 		pkg = parsed.xtest
 	}
+	if pkg == nil {
+		return nil, &PackageError{Path: "fake package", Err: errNoSuchPackage}
+	}
 
 	var packageName string
 	for _, f := range pkg.pkg.Files {
@@ -45,10 +75,163 @@ func EvalPkg(code string) *Package {
 
 	pkg.path = "fake/" + packageName
 
-	wd, err := os.Getwd()
+	wd, err := l.modules.getwd()
 	if err != nil {
-		panic(fmt.Sprintf("os.Getwd() error: %s", err))
+		return nil, fmt.Errorf("os.Getwd() error: %s", err)
+	}
+
+	checked, checkErr := l.typeCheck(pkg, func(imp types.ImporterFrom) types.ImporterFrom {
+		return importerWithDirOverride(imp, map[string]string{tmpDir: wd})
+	})
+	if checkErr != nil {
+		return nil, checkErr
+	}
+	return checked, nil
+}
+
+// EvalPkgs() is like EvalPkg(), but for several packages that can import
+// each other. pkgs maps import path to file name to source. Each package
+// can have _test.go files, including ones of an external "_test" package,
+// which is returned as "<import path>:xtest". EvalPkgs() returns a *Package
+// per import path and panics if any package fails to parse or type check.
+func EvalPkgs(pkgs map[string]map[string]string) map[string]*Package {
+	return defaultLoader.EvalPkgs(pkgs)
+}
+
+// TryEvalPkgs() is like EvalPkgs(), but returns an error instead of
+// panicking. Parse and type check errors are returned as a *PackageError.
+func TryEvalPkgs(pkgs map[string]map[string]string) (map[string]*Package, error) {
+	return defaultLoader.TryEvalPkgs(pkgs)
+}
+
+// EvalPkgs() is like the package level EvalPkgs(), but imports packages
+// using l's build configuration and caches.
+func (l *Loader) EvalPkgs(pkgs map[string]map[string]string) map[string]*Package {
+	ret, err := l.TryEvalPkgs(pkgs)
+	if err != nil {
+		panic(err.Error())
+	}
+	return ret
+}
+
+// TryEvalPkgs() is like EvalPkgs(), but returns an error instead of
+// panicking.
+func (l *Loader) TryEvalPkgs(pkgs map[string]map[string]string) (map[string]*Package, error) {
+	l.init()
+
+	tmpDir, err := ioutil.TempDir("", "stan_fake_packages")
+	if err != nil {
+		return nil, fmt.Errorf("error making temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	wd, err := l.modules.getwd()
+	if err != nil {
+		return nil, fmt.Errorf("os.Getwd() error: %s", err)
+	}
+
+	var (
+		fset   = token.NewFileSet()
+		parsed = make(map[string]*parsedPackage)
+		// imports of fake packages are resolved as if from wd
+		dirs = make(map[string]string)
+	)
+
+	for path, files := range pkgs {
+		dir := filepath.Join(tmpDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error making package dir: %s", err)
+		}
+		dirs[dir] = wd
+
+		for name, code := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+				return nil, fmt.Errorf("error writing %s: %s", name, err)
+			}
+		}
+
+		pd, err := l.parseDir(dir, fset)
+		if err != nil {
+			return nil, newPackageError(path, err)
+		}
+
+		if pd.code == nil && pd.xtest == nil {
+			return nil, &PackageError{Path: path, Err: errNoSuchPackage}
+		}
+		if pd.code != nil {
+			pd.code.path = path
+			parsed[path] = pd.code
+		}
+		if pd.xtest != nil {
+			pd.xtest.path = path + ":xtest"
+			parsed[pd.xtest.path] = pd.xtest
+		}
+	}
+
+	// check in a fixed order, importees before importers
+	var paths []string
+	for path := range parsed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var (
+		ret      = make(map[string]*Package)
+		fakes    = make(map[string]*types.Package)
+		visiting = make(map[string]bool)
+		check    func(path string) error
+	)
+
+	check = func(path string) error {
+		if ret[path] != nil {
+			return nil
+		}
+		if visiting[path] {
+			return &PackageError{Path: path, Err: fmt.Errorf("import cycle through package %q", path)}
+		}
+		visiting[path] = true
+
+		pkg := parsed[path]
+
+		// an xtest package imports its package under test
+		deps := []string{strings.TrimSuffix(path, ":xtest")}
+		for _, f := range pkg.pkg.Files {
+			for _, imp := range f.Imports {
+				deps = append(deps, strings.Trim(imp.Path.Value, `"`))
+			}
+		}
+		for _, dep := range deps {
+			if dep != path && parsed[dep] != nil {
+				if err := check(dep); err != nil {
+					return err
+				}
+			}
+		}
+
+		checked, err := l.typeCheck(pkg, func(imp types.ImporterFrom) types.ImporterFrom {
+			return fakeImporter{
+				ImporterFrom: importerWithDirOverride(imp, dirs),
+				fakes:        fakes,
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		ret[path] = checked
+		if !strings.HasSuffix(path, ":xtest") {
+			fakes[path] = checked.TypesPkg
+		}
+
+		return nil
+	}
+
+	for _, path := range paths {
+		if err := check(path); err != nil {
+			return nil, err
+		}
 	}
 
-	return typeCheck(pkg, importerWithDirOverride(map[string]string{tmpDir: wd}))
+	return ret, nil
 }
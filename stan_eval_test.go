@@ -50,3 +50,81 @@ func myTest(pkg *Package) []error {
 
 	return ret
 }
+
+func TestEvalPkgs(t *testing.T) {
+	pkgs := EvalPkgs(map[string]map[string]string{
+		"example.com/a": {
+			"a.go": `
+package a
+
+import "example.com/b"
+
+type A struct {
+	B b.B
+}
+`,
+			"a_test.go": `
+package a
+
+var testOnly = 1
+`,
+			"a_x_test.go": `
+package a_test
+
+import (
+	"testing"
+
+	"example.com/a"
+	"example.com/b"
+)
+
+func TestA(t *testing.T) {
+	_ = a.A{B: b.New()}
+}
+`,
+		},
+		"example.com/b": {
+			"b.go": `
+package b
+
+import "strings"
+
+type B struct {
+	s strings.Builder
+}
+
+func New() B {
+	return B{}
+}
+`,
+		},
+	})
+
+	if len(pkgs) != 3 {
+		t.Fatalf("got %v", pkgs)
+	}
+
+	a, b, xtest := pkgs["example.com/a"], pkgs["example.com/b"], pkgs["example.com/a:xtest"]
+
+	// packages share objects
+	newB := b.LookupObject("example.com/b.New")
+	if len(xtest.LifetimeOf(newB).Uses) != 1 {
+		t.Error("expected xtest to use b.New")
+	}
+
+	bType := b.LookupType("example.com/b.B")
+	field := a.LookupObject("example.com/a.A.B")
+	if !types.Identical(field.Type(), bType) {
+		t.Errorf("got %s", field.Type())
+	}
+
+	a.LookupObject("example.com/a.testOnly")
+
+	_, err := TryEvalPkgs(map[string]map[string]string{
+		"example.com/c": {"c.go": "package c\n\nimport \"example.com/d\"\n\nvar C = d.D\n"},
+		"example.com/d": {"d.go": "package d\n\nimport \"example.com/c\"\n\nvar D = c.C\n"},
+	})
+	if err == nil {
+		t.Error("expected import cycle error")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/build"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/tools/go/gcexportdata"
+)
+
+// bump when the key or file format changes
+const exportCacheVersion = "stan-export-1"
+
+// DefaultCacheDir() returns a directory suitable for Loader.CacheDir, or ""
+// if there is no user cache directory.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "stan")
+}
+
+// exportKey returns the cache key of bp, which must have been found with
+// p.ctxt. The key covers the build configuration, Go version, contents of
+// bp's files and the keys of bp's imports, so a change to any dependency
+// yields a new key. exportKey returns false if bp can't be cached, e.g.
+// because one of its imports was type checked by the Loader rather than
+// imported by p. Imports are imported as a side effect.
+func (p *srcImporter) exportKey(bp *build.Package, stack *importStack) (string, bool) {
+	h := sha256.New()
+
+	fmt.Fprintln(h, exportCacheVersion, runtime.Version())
+	fmt.Fprintln(h, p.ctxt.GOOS, p.ctxt.GOARCH, p.ctxt.Compiler, p.ctxt.InstallSuffix, p.ctxt.CgoEnabled)
+	fmt.Fprintln(h, strings.Join(p.ctxt.BuildTags, ","))
+	fmt.Fprintln(h, bp.ImportPath)
+
+	if len(bp.CgoFiles) > 0 {
+		// C headers aren't hashed, but at least notice flag changes
+		for _, env := range []string{"CC", "CGO_CFLAGS", "CGO_CPPFLAGS"} {
+			fmt.Fprintln(h, env, os.Getenv(env))
+		}
+	}
+
+	for _, names := range [][]string{bp.GoFiles, bp.CgoFiles} {
+		for _, name := range names {
+			if err := p.hashFile(h, p.joinPath(bp.Dir, name)); err != nil {
+				return "", false
+			}
+		}
+	}
+
+	for _, imp := range bp.Imports {
+		switch imp {
+		case "C":
+			continue
+		case "unsafe":
+			fmt.Fprintln(h, imp)
+			continue
+		}
+
+		dep, err := p.importFrom(imp, bp.Dir, 0, stack)
+		if err != nil {
+			return "", false
+		}
+
+		p.mu.Lock()
+		depKey, found := p.exportKeys[dep.Path()]
+		p.mu.Unlock()
+		if !found {
+			return "", false
+		}
+		fmt.Fprintln(h, dep.Path(), depKey)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (p *srcImporter) hashFile(w io.Writer, name string) error {
+	var (
+		f   io.ReadCloser
+		err error
+	)
+	if open := p.ctxt.OpenFile; open != nil {
+		f, err = open(name)
+	} else {
+		f, err = os.Open(name)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fh := sha256.New()
+	if _, err := io.Copy(fh, f); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s %x\n", filepath.Base(name), fh.Sum(nil))
+
+	return nil
+}
+
+func (p *srcImporter) exportFile(key string) string {
+	return filepath.Join(p.cacheDir, key[:2], key)
+}
+
+// readExport returns the cached package for key, or nil if there is none.
+func (p *srcImporter) readExport(path, key string) *types.Package {
+	f, err := os.Open(p.exportFile(key))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// the reader adds pkg (and looks up its dependencies) in p.packages
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pkg, err := gcexportdata.Read(bufio.NewReader(f), p.fset, p.packages, path)
+	if err != nil {
+		delete(p.packages, path)
+		return nil
+	}
+
+	return pkg
+}
+
+// writeExport stores pkg under key. The cache is best effort, so errors are
+// ignored.
+func (p *srcImporter) writeExport(key string, pkg *types.Package) {
+	name := p.exportFile(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+
+	// write to a temp file and rename so concurrent readers never see a
+	// partial file
+	f, err := ioutil.TempFile(filepath.Dir(name), key+".tmp")
+	if err != nil {
+		return
+	}
+
+	w := bufio.NewWriter(f)
+	err = gcexportdata.Write(w, p.fset, pkg)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "stan_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	cached := func() map[string]time.Time {
+		ret := make(map[string]time.Time)
+		filepath.Walk(cacheDir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				ret[filepath.Base(path)] = fi.ModTime()
+			}
+			return nil
+		})
+		return ret
+	}
+
+	load := func(overlay map[string][]byte) *Package {
+		l := NewLoader(build.Default)
+		l.CacheDir = cacheDir
+		l.Overlay = overlay
+		return l.Pkgs("github.com/retailnext/stan/internal/foo")[0]
+	}
+
+	checkImport := func(foo *Package) {
+		barType := foo.LookupType("github.com/retailnext/stan/internal/bar.BarType")
+		if barType.String() != "github.com/retailnext/stan/internal/bar.BarType" {
+			t.Errorf("got %s", barType)
+		}
+	}
+
+	checkImport(load(nil))
+
+	first := cached()
+	if len(first) < 2 {
+		// bar and syscall at least
+		t.Fatalf("expected cached packages, got %v", first)
+	}
+
+	// everything comes from the cache the second time around
+	checkImport(load(nil))
+	second := cached()
+	if len(second) != len(first) {
+		t.Errorf("expected no new cache entries, got %d vs %d", len(second), len(first))
+	}
+	for key, mtime := range first {
+		if !second[key].Equal(mtime) {
+			t.Errorf("entry %s was rewritten", key)
+		}
+	}
+
+	// changing bar yields a new entry for bar only
+	barFile, err := filepath.Abs(filepath.Join("internal", "bar", "bar.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := ioutil.ReadFile(barFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImport(load(map[string][]byte{
+		barFile: append(src, "\nvar CacheTestVar int\n"...),
+	}))
+	if third := cached(); len(third) != len(first)+1 {
+		t.Errorf("expected one new cache entry, got %d vs %d", len(third), len(first))
+	}
+}
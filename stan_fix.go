@@ -0,0 +1,218 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SuggestedFix is a mechanical fix for a Diagnostic.
+type SuggestedFix struct {
+	// Description of the fix, e.g. "Use Equal()"
+	Message string
+	// Edits making up the fix, which are applied all or nothing
+	TextEdits []TextEdit
+}
+
+// TextEdit replaces the source from Pos to End with NewText. Pos and End
+// must be in the same file. Use Pos == End to insert text.
+type TextEdit struct {
+	Pos, End token.Position
+	NewText  []byte
+}
+
+// ReplaceNode() returns a TextEdit replacing n with newText.
+func (p *Package) ReplaceNode(n ast.Node, newText string) TextEdit {
+	return TextEdit{
+		Pos:     p.Fset.Position(n.Pos()),
+		End:     p.Fset.Position(n.End()),
+		NewText: []byte(newText),
+	}
+}
+
+// ReplaceWithNode() returns a TextEdit replacing n with the formatted source
+// of replacement. replacement can be built from parts of p's AST.
+func (p *Package) ReplaceWithNode(n, replacement ast.Node) TextEdit {
+	return p.ReplaceNode(n, p.NodeString(replacement))
+}
+
+// InsertBefore() returns a TextEdit inserting text right before n.
+func (p *Package) InsertBefore(n ast.Node, text string) TextEdit {
+	pos := p.Fset.Position(n.Pos())
+	return TextEdit{Pos: pos, End: pos, NewText: []byte(text)}
+}
+
+// DeleteNode() returns a TextEdit deleting n.
+func (p *Package) DeleteNode(n ast.Node) TextEdit {
+	return p.ReplaceNode(n, "")
+}
+
+// NodeString() returns the formatted source of n, e.g. for building the text
+// of a TextEdit.
+func (p *Package) NodeString(n ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, p.Fset, n); err != nil {
+		panic(fmt.Sprintf("error formatting %T: %s", n, err))
+	}
+	return buf.String()
+}
+
+// FixMode controls what ApplyFixes() does with fixed files.
+type FixMode int
+
+const (
+	// Write fixed files in place.
+	FixWrite FixMode = iota
+	// Write a unified diff of the fixes.
+	FixDiff
+	// Change nothing, but return an error if fixes would change code.
+	FixDryRun
+)
+
+// ApplyFixes() applies the first suggested fix of each of diags to the files
+// on disk. Fixes conflicting with an earlier fix (with an overlapping edit)
+// are skipped, so running checks and ApplyFixes() again may fix more.
+// Identical edits of different fixes are applied once. Fixed files are
+// gofmt'ed, then, depending on mode, written, diffed to w or reported in an
+// error. Diffs name files relative to the repository root of the working
+// directory (see RepoRoot()) if they are in it. ApplyFixes() returns the names
+// of the files that were (or would be) changed, in order.
+func ApplyFixes(diags []Diagnostic, mode FixMode, w io.Writer) ([]string, error) {
+	edits := make(map[string][]TextEdit)
+
+Diags:
+	for _, d := range diags {
+		if len(d.SuggestedFixes) == 0 {
+			continue
+		}
+		fix := d.SuggestedFixes[0]
+
+		var add []TextEdit
+		for _, e := range fix.TextEdits {
+			if e.Pos.Filename != e.End.Filename || e.End.Offset < e.Pos.Offset {
+				return nil, fmt.Errorf("%s: invalid edit range for fix %q", e.Pos, fix.Message)
+			}
+
+			duplicate := false
+			for _, other := range edits[e.Pos.Filename] {
+				if other.Pos.Offset == e.Pos.Offset && other.End.Offset == e.End.Offset &&
+					bytes.Equal(other.NewText, e.NewText) {
+					duplicate = true
+					break
+				}
+				if editsOverlap(e, other) {
+					continue Diags
+				}
+			}
+			if !duplicate {
+				add = append(add, e)
+			}
+		}
+
+		for _, e := range add {
+			edits[e.Pos.Filename] = append(edits[e.Pos.Filename], e)
+		}
+	}
+
+	var names []string
+	for name := range edits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		changed []string
+		root    = RepoRoot(".")
+	)
+
+	for _, name := range names {
+		orig, err := ioutil.ReadFile(name)
+		if err != nil {
+			return changed, err
+		}
+
+		fixed, err := applyEdits(orig, edits[name])
+		if err != nil {
+			return changed, fmt.Errorf("%s: %s", name, err)
+		}
+
+		if formatted, err := format.Source(fixed); err != nil {
+			return changed, fmt.Errorf("%s: fixed code doesn't parse: %s", name, err)
+		} else {
+			fixed = formatted
+		}
+
+		if bytes.Equal(orig, fixed) {
+			continue
+		}
+		changed = append(changed, name)
+
+		switch mode {
+		case FixWrite:
+			fi, err := os.Stat(name)
+			if err != nil {
+				return changed, err
+			}
+			if err := ioutil.WriteFile(name, fixed, fi.Mode()); err != nil {
+				return changed, err
+			}
+		case FixDiff:
+			if err := unifiedDiff(w, relPath(root, name), orig, fixed); err != nil {
+				return changed, err
+			}
+		}
+	}
+
+	if mode == FixDryRun && len(changed) > 0 {
+		return changed, fmt.Errorf("fixes would change %s", strings.Join(changed, ", "))
+	}
+
+	return changed, nil
+}
+
+func editsOverlap(a, b TextEdit) bool {
+	if a.Pos.Offset == a.End.Offset || b.Pos.Offset == b.End.Offset {
+		// insertions only conflict with edits surrounding them, or
+		// other insertions at the same place
+		if a.Pos.Offset == b.Pos.Offset && a.End.Offset == b.End.Offset {
+			return true
+		}
+		return a.Pos.Offset > b.Pos.Offset && a.Pos.Offset < b.End.Offset ||
+			b.Pos.Offset > a.Pos.Offset && b.Pos.Offset < a.End.Offset
+	}
+	return a.Pos.Offset < b.End.Offset && b.Pos.Offset < a.End.Offset
+}
+
+// applyEdits applies non-overlapping edits to src.
+func applyEdits(src []byte, edits []TextEdit) ([]byte, error) {
+	sorted := append([]TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Pos.Offset < sorted[j].Pos.Offset
+	})
+
+	var (
+		buf  bytes.Buffer
+		last int
+	)
+	for _, e := range sorted {
+		if e.Pos.Offset < last || e.End.Offset > len(src) {
+			return nil, fmt.Errorf("edit at %s out of range", e.Pos)
+		}
+		buf.Write(src[last:e.Pos.Offset])
+		buf.Write(e.NewText)
+		last = e.End.Offset
+	}
+	buf.Write(src[last:])
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var timeEqualCheck = &Check{
+	Name: "timeequal",
+	Func: func(pkg *Package, r Reporter) {
+		for _, f := range pkg.Files() {
+			ast.Inspect(f, func(n ast.Node) bool {
+				binary, _ := n.(*ast.BinaryExpr)
+				if binary == nil || binary.Op != token.EQL {
+					return true
+				}
+				if typ := pkg.TypeOf(binary.X); typ == nil || typ.String() != "time.Time" {
+					return true
+				}
+
+				r.Report(Diagnostic{
+					Pos:     pkg.Pos(binary),
+					Message: "use Equal() to compare time.Time values",
+					SuggestedFixes: []SuggestedFix{{
+						Message: "Use Equal()",
+						TextEdits: []TextEdit{
+							pkg.ReplaceNode(binary, pkg.NodeString(binary.X)+".Equal("+pkg.NodeString(binary.Y)+")"),
+						},
+					}},
+				})
+				return true
+			})
+		}
+	},
+}
+
+const timeEqualSrc = `package fix
+
+import "time"
+
+func Same(a, b time.Time) bool {
+	return a == b
+}
+
+func SameAsNow(a time.Time) bool {
+	return a ==   time.Now()
+}
+`
+
+const timeEqualFixed = `package fix
+
+import "time"
+
+func Same(a, b time.Time) bool {
+	return a.Equal(b)
+}
+
+func SameAsNow(a time.Time) bool {
+	return a.Equal(time.Now())
+}
+`
+
+func TestApplyFixes(t *testing.T) {
+	dir := writeModule(t, "example.com/fix", map[string]string{"fix.go": timeEqualSrc})
+	name := filepath.Join(dir, "fix.go")
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+
+	diags := timeEqualCheck.Diagnose(l.Pkgs("example.com/fix")[0])
+	if len(diags) != 2 {
+		t.Fatalf("got %v", diags)
+	}
+
+	changed, err := ApplyFixes(diags, FixDryRun, nil)
+	if err == nil || len(changed) != 1 || changed[0] != name {
+		t.Errorf("got %v, %v", changed, err)
+	}
+
+	var diff bytes.Buffer
+	if _, err := ApplyFixes(diags, FixDiff, &diff); err != nil {
+		t.Fatal(err)
+	}
+	// name is outside the repository, so it's left absolute
+	expectedDiff := `--- ` + name + `
++++ ` + name + `
+@@ -3,9 +3,9 @@
+ import "time"
+ 
+ func Same(a, b time.Time) bool {
+-	return a == b
++	return a.Equal(b)
+ }
+ 
+ func SameAsNow(a time.Time) bool {
+-	return a ==   time.Now()
++	return a.Equal(time.Now())
+ }
+`
+	if diff.String() != expectedDiff {
+		t.Errorf("got diff:\n%s", diff.String())
+	}
+
+	// conflicting fix is skipped, duplicate edit is applied once
+	conflicting := diags[0]
+	conflicting.SuggestedFixes = []SuggestedFix{{
+		TextEdits: []TextEdit{{Pos: diags[0].Pos, End: diags[0].Pos, NewText: []byte("!")}},
+	}}
+	conflicting.SuggestedFixes[0].TextEdits[0].Pos.Offset++
+	conflicting.SuggestedFixes[0].TextEdits[0].End.Offset++
+	diags = append(diags, conflicting, diags[1])
+
+	changed, err = ApplyFixes(diags, FixWrite, nil)
+	if err != nil || len(changed) != 1 {
+		t.Errorf("got %v, %v", changed, err)
+	}
+	if got, _ := ioutil.ReadFile(name); string(got) != timeEqualFixed {
+		t.Errorf("got:\n%s", got)
+	}
+
+	// already fixed
+	pkgs, err := l.ReloadPkgs("example.com/fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err = ApplyFixes(timeEqualCheck.Diagnose(pkgs[0]), FixDryRun, nil)
+	if err != nil || len(changed) != 0 {
+		t.Errorf("got %v, %v", changed, err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Repeat("same\n", 10) + "old\n" + strings.Repeat("same\n", 10) + "last"
+	b := strings.Repeat("same\n", 10) + "new\n" + strings.Repeat("same\n", 10) + "last\n"
+
+	var buf bytes.Buffer
+	if err := unifiedDiff(&buf, "x", []byte(a), []byte(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `--- a/x
++++ b/x
+@@ -8,7 +8,7 @@
+ same
+ same
+ same
+-old
++new
+ same
+ same
+ same
+@@ -19,4 +19,4 @@
+ same
+ same
+ same
+-last
+\ No newline at end of file
++last
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := unifiedDiff(&buf, "/abs/x", []byte(a), []byte(b)); err != nil || !strings.HasPrefix(buf.String(), "--- /abs/x\n+++ /abs/x\n@@") {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := unifiedDiff(&buf, "x", []byte(a), []byte(a)); err != nil || buf.Len() != 0 {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
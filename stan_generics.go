@@ -0,0 +1,195 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Instance is an instantiation of a generic type or function.
+type Instance struct {
+	// Identifier denoting the generic type or function
+	Ident *ast.Ident
+	// Type arguments, whether explicit or inferred
+	TypeArgs []types.Type
+	// Instantiated type; a *types.Signature for functions
+	Type types.Type
+	// Call expression, if the instance is a called function
+	Call *ast.CallExpr
+}
+
+// InstancesOf() returns the instantiations of generic type or function obj
+// within p, in source order. Methods of generic types aren't instantiated on
+// their own; use InstancesOf() on the type, or InvocationsOf() on the
+// method.
+func (p *Package) InstancesOf(obj types.Object) []Instance {
+	obj = originOf(obj)
+
+	var ret []Instance
+	for id, inst := range p.TypesInfo.Instances {
+		if originOf(p.TypesInfo.Uses[id]) != obj {
+			continue
+		}
+
+		i := Instance{
+			Ident: id,
+			Type:  inst.Type,
+		}
+		for ai := 0; ai < inst.TypeArgs.Len(); ai++ {
+			i.TypeArgs = append(i.TypeArgs, inst.TypeArgs.At(ai))
+		}
+		if _, isFunc := inst.Type.(*types.Signature); isFunc {
+			i.Call, _ = callOf(id, p.AncestorsOf(id))
+		}
+
+		ret = append(ret, i)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Ident.Pos() < ret[j].Ident.Pos()
+	})
+
+	return ret
+}
+
+// callOf returns the call expression calling the function denoted by id, or
+// nil if id isn't called. id can be qualified (pkg.F, x.M) and explicitly
+// instantiated (F[int]). callOf also returns the selector qualifying id, if
+// any.
+func callOf(id *ast.Ident, ancs Ancestors) (*ast.CallExpr, *ast.SelectorExpr) {
+	var fun ast.Expr = id
+
+	sel, _ := ancs.Peek().(*ast.SelectorExpr)
+	if sel != nil && sel.Sel == id {
+		fun = sel
+		ancs.Pop()
+	} else {
+		sel = nil
+	}
+
+	switch x := ancs.Peek().(type) {
+	case *ast.IndexExpr:
+		if x.X == fun {
+			fun = x
+			ancs.Pop()
+		}
+	case *ast.IndexListExpr:
+		if x.X == fun {
+			fun = x
+			ancs.Pop()
+		}
+	}
+
+	call, _ := ancs.Peek().(*ast.CallExpr)
+	if call == nil || call.Fun != fun {
+		return nil, sel
+	}
+	return call, sel
+}
+
+// originOf returns the generic object obj was instantiated from, or obj.
+func originOf(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+// instantiate instantiates generic type or function obj with args, which are
+// type specs as accepted by LookupType().
+func (p *Package) instantiate(obj types.Object, args []string) (types.Type, error) {
+	switch obj.(type) {
+	case *types.TypeName, *types.Func:
+	default:
+		return nil, fmt.Errorf("%s is not a generic type or function", obj)
+	}
+
+	targs := make([]types.Type, len(args))
+	for i, arg := range args {
+		var err error
+		if targs[i], err = p.TryLookupType(strings.TrimSpace(arg)); err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := types.Instantiate(nil, obj.Type(), targs, true)
+	if err != nil {
+		return nil, fmt.Errorf("error instantiating %s: %s", obj, err)
+	}
+	return t, nil
+}
+
+// splitTypeArgs splits "Name[A,B]" into "Name" and ["A", "B"]. Name can be
+// qualified with an import path. args is nil if spec isn't a name followed
+// by type arguments, e.g. for "[]example.com/pkg.List[int]".
+func splitTypeArgs(spec string) (name string, args []string) {
+	if !strings.HasSuffix(spec, "]") {
+		return spec, nil
+	}
+
+	// the bracket matching the final one, since type arguments can have
+	// brackets of their own
+	depth := 0
+	i := len(spec) - 1
+	for ; i >= 0; i-- {
+		if spec[i] == ']' {
+			depth++
+		} else if spec[i] == '[' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+
+	if i <= 0 || nameEnd(spec, 0) != i {
+		return spec, nil
+	}
+	return spec[:i], splitTopLevel(spec[i+1:len(spec)-1], ',')
+}
+
+// nameEnd returns the end of the (possibly qualified) name starting at
+// s[start], i.e. the index of the first byte that can't be part of an
+// identifier or import path.
+func nameEnd(s string, start int) int {
+	i := start
+	for ; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80 || strings.IndexByte("_./-~", c) >= 0) {
+			break
+		}
+	}
+	return i
+}
+
+// splitTopLevel splits s at each sep not nested in brackets, parens or
+// braces.
+func splitTopLevel(s string, sep byte) []string {
+	var (
+		ret   []string
+		depth int
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, s[start:])
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/types"
+	"testing"
+)
+
+func TestGenerics(t *testing.T) {
+	const genericPath = "github.com/retailnext/stan/internal/generic"
+
+	user := Pkgs(genericPath + "/user")[0]
+
+	for spec, expected := range map[string]string{
+		genericPath + ".List[int]":                                genericPath + ".List[int]",
+		"*" + genericPath + ".List[string]":                       "*" + genericPath + ".List[string]",
+		genericPath + ".Map[string,*bytes.Buffer]":                genericPath + ".Map[string, *bytes.Buffer]",
+		genericPath + ".List[" + genericPath + ".Map[int,[]int]]": genericPath + ".List[" + genericPath + ".Map[int, []int]]",
+		genericPath + ".Keys[string, int]":                        "func(m " + genericPath + ".Map[string, int]) []string",
+	} {
+		typ, err := user.TryLookupType(spec)
+		if err != nil {
+			t.Errorf("%s: %s", spec, err)
+			continue
+		}
+		if typ.String() != expected {
+			t.Errorf("%s: got %s", spec, typ)
+		}
+	}
+
+	// type expressions containing instantiations, written as they print
+	for _, spec := range []string{
+		"[]" + genericPath + ".List[int]",
+		"map[string]*" + genericPath + ".List[int]",
+		"func(" + genericPath + ".List[int], ...*bytes.Buffer) " + genericPath + ".Map[string, int]",
+	} {
+		if typ, err := user.TryLookupType(spec); err != nil {
+			t.Errorf("%s: %s", spec, err)
+		} else if typ.String() != spec {
+			t.Errorf("%s: got %s", spec, typ)
+		}
+	}
+
+	listOfInt := user.LookupType(genericPath + ".List[int]")
+
+	if _, err := user.TryLookupType(genericPath + ".List[int,int]"); err == nil {
+		t.Error("expected error for wrong number of type arguments")
+	}
+	if _, err := user.TryLookupType(genericPath + ".Map[[]int,int]"); err == nil {
+		t.Error("expected error for unsatisfied constraint")
+	}
+
+	push := user.LookupObject(genericPath + ".List[int].Push")
+	if sig := push.Type().(*types.Signature); sig.Params().At(0).Type().String() != "int" {
+		t.Errorf("got %s", sig)
+	}
+
+	genericPush := user.LookupObject(genericPath + ".List.Push")
+	if push.(*types.Func).Origin() != genericPush {
+		t.Error("expected Push[int] to originate from Push")
+	}
+
+	// both the generic and the instantiated method have all uses
+	for _, obj := range []types.Object{push, genericPush} {
+		if uses := len(user.LifetimeOf(obj).Uses); uses != 3 {
+			t.Errorf("got %d uses", uses)
+		}
+		// the method value is invoked through push
+		if invs := user.InvocationsOf(obj); len(invs) != 3 || invs[2].Value == nil {
+			t.Errorf("got %d invocations", len(invs))
+		}
+	}
+
+	keys := user.LookupObject(genericPath + ".Keys")
+	invs := user.InvocationsOf(keys)
+	if len(invs) != 2 {
+		t.Fatalf("got %d invocations", len(invs))
+	}
+
+	instances := user.InstancesOf(keys)
+	if len(instances) != 2 {
+		t.Fatalf("got %d instances", len(instances))
+	}
+	for i, expected := range []string{"[string *bytes.Buffer]", "[int int]"} {
+		if got := typesString(instances[i].TypeArgs); got != expected {
+			t.Errorf("got %s", got)
+		}
+		if instances[i].Call != invs[i].Call {
+			t.Errorf("instance %d has wrong call", i)
+		}
+	}
+
+	var listArgs []string
+	for _, inst := range user.InstancesOf(user.LookupObject(genericPath + ".List")) {
+		if inst.Call != nil {
+			t.Error("type instance has call")
+		}
+		if !types.Identical(inst.Type, listOfInt) {
+			listArgs = append(listArgs, typesString(inst.TypeArgs))
+		}
+	}
+	if len(listArgs) != 1 || listArgs[0] != "[string]" {
+		t.Errorf("got %v", listArgs)
+	}
+}
+
+func typesString(ts []types.Type) string {
+	return fmt.Sprint(ts)
+}
+
+func TestSplitTypeArgs(t *testing.T) {
+	for spec, expected := range map[string][]string{
+		"example.com/pkg.List[int]":                       {"example.com/pkg.List", "int"},
+		"example.com/pkg.Map[[]int,example.com/pkg.T[a]]": {"example.com/pkg.Map", "[]int", "example.com/pkg.T[a]"},
+		"example.com/pkg.List":                            nil,
+		"[]example.com/pkg.List[int]":                     nil,
+		"func() example.com/pkg.List[int]":                nil,
+		"map[string]example.com/pkg.List[int]":            nil,
+	} {
+		name, args := splitTypeArgs(spec)
+		var got []string
+		if args != nil {
+			got = append([]string{name}, args...)
+		} else if name != spec {
+			t.Errorf("%s: got name %s", spec, name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: got %q", spec, got)
+		}
+	}
+}
@@ -21,12 +21,61 @@ import (
 // - rename New() constructor to newSrcImporter()
 // - add call to cgoIfRequired() in ImportFrom()
 // - set FakeImportC to false in types.Config
+// - resolve import paths through go.mod (moduleResolver) before falling back
+//   to the build context
+// - optionally use export data from an on-disk cache (see
+//   stan_export_cache.go)
+// - make srcImporter safe for concurrent use: packages being imported are
+//   tracked per path (importCall) instead of with the "importing" sentinel,
+//   and each import chain carries an importStack to detect cycles
+// - add checkSource() to type check a package with function bodies, for
+//   analyzers computing facts of dependencies
 
 type srcImporter struct {
 	ctxt     *build.Context
 	fset     *token.FileSet
 	sizes    types.Sizes
 	packages map[string]*types.Package
+	modules  *moduleResolver
+
+	// export data cache; disabled if cacheDir is empty
+	cacheDir string
+
+	// guards packages, inflight, exportKeys and importStack.waiting
+	mu         sync.Mutex
+	inflight   map[string]*importCall
+	exportKeys map[string]string
+}
+
+// importCall is a package import in progress.
+type importCall struct {
+	owner *importStack
+	done  chan struct{}
+	// set once done, possibly before waiters have woken up
+	finished bool
+	pkg      *types.Package
+	err      error
+}
+
+// importStack is shared by the nested imports of a single top level
+// ImportFrom() call, which all happen on the same goroutine.
+type importStack struct {
+	// import the goroutine is waiting on, if any
+	waiting *importCall
+}
+
+// stackImporter is the importer for the package being imported by stack.
+type stackImporter struct {
+	p     *srcImporter
+	stack *importStack
+}
+
+func (i stackImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, "", 0)
+}
+
+func (i stackImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	return i.p.importFrom(path, srcDir, mode, i.stack)
 }
 
 // NewImporter returns a new Importer for the given context, file set, and map
@@ -35,19 +84,19 @@ type srcImporter struct {
 // non-nil file system functions, they are used instead of the regular package
 // os functions. The file set is used to track position information of package
 // files; and imported packages are added to the packages map.
-func newSrcImporter(ctxt *build.Context, fset *token.FileSet, packages map[string]*types.Package) *srcImporter {
+func newSrcImporter(ctxt *build.Context, fset *token.FileSet, packages map[string]*types.Package, modules *moduleResolver, cacheDir string) *srcImporter {
 	return &srcImporter{
-		ctxt:     ctxt,
-		fset:     fset,
-		sizes:    types.SizesFor(ctxt.Compiler, ctxt.GOARCH), // uses go/types default if GOARCH not found
-		packages: packages,
+		ctxt:       ctxt,
+		fset:       fset,
+		sizes:      types.SizesFor(ctxt.Compiler, ctxt.GOARCH), // uses go/types default if GOARCH not found
+		packages:   packages,
+		modules:    modules,
+		cacheDir:   cacheDir,
+		inflight:   make(map[string]*importCall),
+		exportKeys: make(map[string]string),
 	}
 }
 
-// Importing is a sentinel taking the place in Importer.packages
-// for a package that is in the process of being imported.
-var importing types.Package
-
 // Import(path) is a shortcut for ImportFrom(path, "", 0).
 func (p *srcImporter) Import(path string) (*types.Package, error) {
 	return p.ImportFrom(path, "", 0)
@@ -60,27 +109,15 @@ func (p *srcImporter) Import(path string) (*types.Package, error) {
 // Packages that are not comprised entirely of pure Go files may fail to import because the
 // type checker may not be able to determine all exported entities (e.g. due to cgo dependencies).
 func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	return p.importFrom(path, srcDir, mode, new(importStack))
+}
+
+func (p *srcImporter) importFrom(path, srcDir string, mode types.ImportMode, stack *importStack) (*types.Package, error) {
 	if mode != 0 {
 		panic("non-zero import mode")
 	}
 
-	// determine package path (do vendor resolution)
-	var bp *build.Package
-	var err error
-	switch {
-	default:
-		if abs, err := p.absPath(srcDir); err == nil { // see issue #14282
-			srcDir = abs
-		}
-		bp, err = p.ctxt.Import(path, srcDir, build.FindOnly)
-
-	case build.IsLocalImport(path):
-		// "./x" -> "srcDir/x"
-		bp, err = p.ctxt.ImportDir(filepath.Join(srcDir, path), build.FindOnly)
-
-	case p.isAbsPath(path):
-		return nil, fmt.Errorf("invalid absolute import path %q", path)
-	}
+	bp, modulePath, err := p.find(path, srcDir)
 	if err != nil {
 		return nil, err // err may be *build.NoGoError - return as is
 	}
@@ -90,12 +127,12 @@ func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*t
 		return types.Unsafe, nil
 	}
 
+	p.mu.Lock()
+
 	// no need to re-import if the package was imported completely before
 	pkg := p.packages[bp.ImportPath]
 	if pkg != nil {
-		if pkg == &importing {
-			return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
-		}
+		p.mu.Unlock()
 		if !pkg.Complete() {
 			// Package exists but is not complete - we cannot handle this
 			// at the moment since the source importer replaces the package
@@ -106,22 +143,156 @@ func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*t
 		return pkg, nil
 	}
 
-	p.packages[bp.ImportPath] = &importing
-	defer func() {
-		// clean up in case of error
-		// TODO(gri) Eventually we may want to leave a (possibly empty)
-		// package in the map in all cases (and use that package to
-		// identify cycles). See also issue 16088.
-		if p.packages[bp.ImportPath] == &importing {
-			p.packages[bp.ImportPath] = nil
+	// wait for another goroutine importing the same package, unless that
+	// goroutine is (transitively) waiting for us
+	if call := p.inflight[bp.ImportPath]; call != nil {
+		for c := call; c != nil && !c.finished; c = c.owner.waiting {
+			if c.owner == stack {
+				p.mu.Unlock()
+				return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
+			}
+		}
+		stack.waiting = call
+		p.mu.Unlock()
+
+		<-call.done
+
+		p.mu.Lock()
+		stack.waiting = nil
+		p.mu.Unlock()
+
+		return call.pkg, call.err
+	}
+
+	call := &importCall{owner: stack, done: make(chan struct{})}
+	p.inflight[bp.ImportPath] = call
+	p.mu.Unlock()
+
+	call.pkg, call.err = p.load(bp, modulePath, stack)
+
+	p.mu.Lock()
+	delete(p.inflight, bp.ImportPath)
+	call.finished = true
+	if call.err == nil {
+		p.packages[bp.ImportPath] = call.pkg
+	}
+	p.mu.Unlock()
+
+	close(call.done)
+
+	return call.pkg, call.err
+}
+
+// find locates the package imported as path from srcDir, with
+// build.FindOnly. modulePath is set if path was resolved through go.mod.
+func (p *srcImporter) find(path, srcDir string) (bp *build.Package, modulePath string, err error) {
+	// determine package path (do vendor resolution)
+	switch {
+	default:
+		if abs, err := p.absPath(srcDir); err == nil { // see issue #14282
+			srcDir = abs
 		}
-	}()
+		var (
+			dir   string
+			found bool
+		)
+		dir, found, err = p.modules.importDir(path, srcDir)
+		if err != nil {
+			break
+		}
+		if found {
+			bp, err = p.ctxt.ImportDir(dir, build.FindOnly)
+			if err == nil {
+				// module packages aren't under GOPATH so ImportDir
+				// can't figure out the import path
+				bp.ImportPath = path
+				modulePath = path
+			}
+		} else {
+			bp, err = p.ctxt.Import(path, srcDir, build.FindOnly)
+		}
+
+	case build.IsLocalImport(path):
+		// "./x" -> "srcDir/x"
+		bp, err = p.ctxt.ImportDir(filepath.Join(srcDir, path), build.FindOnly)
 
+	case p.isAbsPath(path):
+		return nil, "", fmt.Errorf("invalid absolute import path %q", path)
+	}
+	return bp, modulePath, err
+}
+
+// load imports the package found (with build.FindOnly) as bp.
+func (p *srcImporter) load(bp *build.Package, modulePath string, stack *importStack) (*types.Package, error) {
 	// collect package files
-	bp, err = p.ctxt.ImportDir(bp.Dir, 0)
+	bp, err := p.ctxt.ImportDir(bp.Dir, 0)
 	if err != nil {
 		return nil, err // err may be *build.NoGoError - return as is
 	}
+	if modulePath != "" {
+		bp.ImportPath = modulePath
+	}
+
+	var exportKey string
+	if p.cacheDir != "" {
+		if key, ok := p.exportKey(bp, stack); ok {
+			if pkg := p.readExport(bp.ImportPath, key); pkg != nil {
+				p.setExportKey(bp.ImportPath, key)
+				return pkg, nil
+			}
+			exportKey = key
+		}
+	}
+
+	files, err := p.packageFiles(bp)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := p.check(bp.ImportPath, files, stack, nil)
+	if err != nil {
+		return pkg, err
+	}
+
+	if exportKey != "" {
+		p.setExportKey(bp.ImportPath, exportKey)
+		p.writeExport(exportKey, pkg)
+	}
+	return pkg, nil
+}
+
+// checkSource type checks the package imported as path from srcDir like
+// ImportFrom(), but with function bodies, recording type information in
+// info. The package isn't added to p's packages; its imports are imported by
+// p as usual.
+func (p *srcImporter) checkSource(path, srcDir string, info *types.Info) (*types.Package, []*ast.File, error) {
+	bp, modulePath, err := p.find(path, srcDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	bp, err = p.ctxt.ImportDir(bp.Dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if modulePath != "" {
+		bp.ImportPath = modulePath
+	}
+
+	files, err := p.packageFiles(bp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkg, err := p.check(bp.ImportPath, files, new(importStack), info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pkg, files, nil
+}
+
+// packageFiles parses the Go files of bp, without tests, running cgo if
+// needed.
+func (p *srcImporter) packageFiles(bp *build.Package) ([]*ast.File, error) {
 	var filenames []string
 	filenames = append(filenames, bp.GoFiles...)
 	filenames = append(filenames, bp.CgoFiles...)
@@ -131,15 +302,16 @@ func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*t
 		return nil, err
 	}
 
-	files, err = cgoIfRequired(bp, p.fset, files)
-	if err != nil {
-		return nil, err
-	}
+	return cgoIfRequired(p.ctxt, bp, p.fset, files)
+}
 
+// check type checks files as the package path. Function bodies are only
+// checked if info is given to record their types in.
+func (p *srcImporter) check(path string, files []*ast.File, stack *importStack, info *types.Info) (*types.Package, error) {
 	// type-check package files
 	var firstHardErr error
 	conf := types.Config{
-		IgnoreFuncBodies: true,
+		IgnoreFuncBodies: info == nil,
 		FakeImportC:      false,
 		// continue type-checking after the first error
 		Error: func(err error) {
@@ -147,10 +319,10 @@ func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*t
 				firstHardErr = err
 			}
 		},
-		Importer: p,
+		Importer: stackImporter{p, stack},
 		Sizes:    p.sizes,
 	}
-	pkg, err = conf.Check(bp.ImportPath, p.fset, files, nil)
+	pkg, err := conf.Check(path, p.fset, files, info)
 	if err != nil {
 		// If there was a hard error it is possibly unsafe
 		// to use the package as it may not be fully populated.
@@ -159,17 +331,60 @@ func (p *srcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*t
 			pkg = nil
 			err = firstHardErr // give preference to first hard error over any soft error
 		}
-		return pkg, fmt.Errorf("type-checking package %q failed (%v)", bp.ImportPath, err)
+		return pkg, fmt.Errorf("type-checking package %q failed (%v)", path, err)
 	}
 	if firstHardErr != nil {
 		// this can only happen if we have a bug in go/types
 		panic("package is not safe yet no error was returned")
 	}
-
-	p.packages[bp.ImportPath] = pkg
 	return pkg, nil
 }
 
+func (p *srcImporter) setExportKey(path, key string) {
+	p.mu.Lock()
+	p.exportKeys[path] = key
+	p.mu.Unlock()
+}
+
+// add makes pkg, type checked elsewhere, available to importers of path
+// unless path was imported already.
+func (p *srcImporter) add(path string, pkg *types.Package) {
+	p.mu.Lock()
+	if p.packages[path] == nil {
+		p.packages[path] = pkg
+	}
+	p.mu.Unlock()
+}
+
+// lookup returns the package imported (or added) for path, or nil.
+func (p *srcImporter) lookup(path string) *types.Package {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.packages[path]
+}
+
+// forget drops path so it is imported again the next time it is needed.
+func (p *srcImporter) forget(path string) {
+	p.mu.Lock()
+	delete(p.packages, path)
+	delete(p.exportKeys, path)
+	p.mu.Unlock()
+}
+
+// imported returns the packages imported so far.
+func (p *srcImporter) imported() []*types.Package {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]*types.Package, 0, len(p.packages))
+	for _, pkg := range p.packages {
+		if pkg != nil {
+			ret = append(ret, pkg)
+		}
+	}
+	return ret
+}
+
 func (p *srcImporter) parseFiles(dir string, filenames []string) ([]*ast.File, error) {
 	open := p.ctxt.OpenFile // possibly nil
 
@@ -187,7 +402,7 @@ func (p *srcImporter) parseFiles(dir string, filenames []string) ([]*ast.File, e
 					errors[i] = fmt.Errorf("opening package file %s failed (%v)", filepath, err)
 					return
 				}
-				files[i], errors[i] = parser.ParseFile(p.fset, filepath, src, 0)
+				files[i], errors[i] = parser.ParseFile(p.fset, filepath, src, parser.ParseComments)
 				src.Close() // ignore Close error - parsing may have succeeded which is all we need
 			} else {
 				// Special-case when ctxt doesn't provide a custom OpenFile and use the
@@ -195,7 +410,7 @@ func (p *srcImporter) parseFiles(dir string, filenames []string) ([]*ast.File, e
 				// bit faster than opening the file and providing an io.ReaderCloser in
 				// both cases.
 				// TODO(gri) investigate performance difference (issue #19281)
-				files[i], errors[i] = parser.ParseFile(p.fset, filepath, nil, 0)
+				files[i], errors[i] = parser.ParseFile(p.fset, filepath, nil, parser.ParseComments)
 			}
 		}(i, p.joinPath(dir, filename))
 	}
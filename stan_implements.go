@@ -0,0 +1,236 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+)
+
+// Implementation is a named type implementing an interface.
+type Implementation struct {
+	// The named, non-interface type
+	Type *types.Named
+	// Whether only *Type implements the interface, because some of the
+	// methods have pointer receivers
+	Pointer bool
+}
+
+// String() returns the implementing type, e.g. "*example.com/pkg.T".
+func (i Implementation) String() string {
+	if i.Pointer {
+		return "*" + i.Type.String()
+	}
+	return i.Type.String()
+}
+
+// ImplementationsOf() returns the named types implementing interface type
+// iface, ordered by name. Types declared in p, in the other packages loaded
+// by p's Loader, and in all packages they import are considered, including
+// types declared in functions. Generic types are not considered.
+// ImplementationsOf() panics if iface is not an interface.
+//
+//	plugin := pkg.LookupType("example.com/plugins.Plugin")
+//	closer := pkg.LookupType("io.Closer").Underlying().(*types.Interface)
+//	for _, impl := range pkg.ImplementationsOf(plugin) {
+//	  if !types.Implements(types.NewPointer(impl.Type), closer) {
+//	    t.Errorf("%s doesn't implement io.Closer", impl)
+//	  }
+//	}
+func (p *Package) ImplementationsOf(iface types.Type) []Implementation {
+	it, _ := iface.Underlying().(*types.Interface)
+	if it == nil {
+		panic(fmt.Sprintf("type %s is not an interface", iface))
+	}
+
+	var ret []Implementation
+	for _, named := range namedTypes(p.knownPkgs()) {
+		if types.IsInterface(named) {
+			continue
+		}
+		if types.Implements(named, it) {
+			ret = append(ret, Implementation{Type: named})
+		} else if types.Implements(types.NewPointer(named), it) {
+			ret = append(ret, Implementation{Type: named, Pointer: true})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Type.String() < ret[j].Type.String()
+	})
+
+	// copies of the same type
+	deduped := ret[:0]
+	for _, impl := range ret {
+		if len(deduped) == 0 || !sameType(impl.Type, deduped[len(deduped)-1].Type) {
+			deduped = append(deduped, impl)
+		}
+	}
+	return deduped
+}
+
+// InterfacesSatisfiedBy() returns the named interfaces that t implements,
+// ordered by name. Pass a pointer type to include methods with pointer
+// receivers. Interfaces are looked for like types in ImplementationsOf().
+// Interfaces without methods, and constraints that aren't ordinary
+// interfaces, are not returned.
+func (p *Package) InterfacesSatisfiedBy(t types.Type) []*types.Named {
+	all := namedTypes(p.knownPkgs())
+
+	// other copies of t, which interfaces loaded along with them refer to
+	copies := []types.Type{t}
+	ptr, isPtr := t.(*types.Pointer)
+	if isPtr {
+		t = ptr.Elem()
+	}
+	if tNamed, _ := t.(*types.Named); tNamed != nil {
+		for _, named := range all {
+			if named != tNamed && sameType(named, tNamed) {
+				if isPtr {
+					copies = append(copies, types.NewPointer(named))
+				} else {
+					copies = append(copies, named)
+				}
+			}
+		}
+	}
+
+	var ret []*types.Named
+	for _, named := range all {
+		it, _ := named.Underlying().(*types.Interface)
+		if it == nil || it.NumMethods() == 0 || !it.IsMethodSet() {
+			continue
+		}
+		if named == t || sameType(named, t) {
+			continue
+		}
+		for _, c := range copies {
+			if types.Implements(c, it) {
+				ret = append(ret, named)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].String() < ret[j].String()
+	})
+
+	// copies of the same interface
+	deduped := ret[:0]
+	for _, named := range ret {
+		if len(deduped) == 0 || !sameType(named, deduped[len(deduped)-1]) {
+			deduped = append(deduped, named)
+		}
+	}
+	return deduped
+}
+
+// sameType reports whether x and y are the same package level type, possibly
+// from different copies of its package.
+func sameType(x, y types.Type) bool {
+	xNamed, _ := x.(*types.Named)
+	yNamed, _ := y.(*types.Named)
+	if xNamed == nil || yNamed == nil {
+		return false
+	}
+	xObj, yObj := xNamed.Obj(), yNamed.Obj()
+	if xObj.Pkg() == nil || yObj.Pkg() == nil || xObj.Parent() != xObj.Pkg().Scope() || yObj.Parent() != yObj.Pkg().Scope() {
+		return xObj == yObj
+	}
+	return xObj.Pkg().Path() == yObj.Pkg().Path() && xObj.Name() == yObj.Name()
+}
+
+// knownPkgs returns p, the packages loaded by p's Loader and the packages
+// imported along the way.
+func (p *Package) knownPkgs() ([]*Package, []*types.Package) {
+	pkgs := []*Package{p}
+	var imported []*types.Package
+
+	if l := p.loader; l != nil {
+		l.init()
+
+		l.mu.Lock()
+		for _, cached := range l.packagesCache {
+			pkgs = append(pkgs, cached...)
+		}
+		l.mu.Unlock()
+
+		imported = l.imp.imported()
+	}
+
+	return pkgs, imported
+}
+
+// namedTypes returns the non-generic named types declared in pkgs (including
+// in functions), in imported and in the packages they transitively import.
+// A type loaded more than once (e.g. a package loaded directly after being
+// imported) is returned once for each copy, since the copies aren't
+// interchangeable in go/types.
+func namedTypes(pkgs []*Package, imported []*types.Package) []*types.Named {
+	var (
+		ret  []*types.Named
+		seen = make(map[*types.TypeName]bool)
+	)
+	add := func(obj types.Object) {
+		tn, _ := obj.(*types.TypeName)
+		if tn == nil || tn.IsAlias() || tn.Pkg() == nil || seen[tn] {
+			return
+		}
+		seen[tn] = true
+
+		named, _ := tn.Type().(*types.Named)
+		if named == nil || named.TypeParams().Len() > 0 {
+			return
+		}
+		ret = append(ret, named)
+	}
+
+	seenPkgs := make(map[*types.Package]bool)
+	var addPkg func(tp *types.Package)
+	addPkg = func(tp *types.Package) {
+		if seenPkgs[tp] {
+			return
+		}
+		seenPkgs[tp] = true
+
+		scope := tp.Scope()
+		for _, name := range scope.Names() {
+			add(scope.Lookup(name))
+		}
+		for _, imp := range tp.Imports() {
+			addPkg(imp)
+		}
+	}
+
+	seenLoaded := make(map[*Package]bool)
+	for _, pkg := range pkgs {
+		if seenLoaded[pkg] {
+			continue
+		}
+		seenLoaded[pkg] = true
+
+		var defs []types.Object
+		for _, obj := range pkg.TypesInfo.Defs {
+			if obj != nil {
+				defs = append(defs, obj)
+			}
+		}
+		sort.Slice(defs, func(i, j int) bool {
+			return defs[i].Pos() < defs[j].Pos()
+		})
+		for _, obj := range defs {
+			add(obj)
+		}
+
+		addPkg(pkg.TypesPkg)
+	}
+
+	for _, tp := range imported {
+		addPkg(tp)
+	}
+
+	return ret
+}
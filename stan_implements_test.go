@@ -0,0 +1,107 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/types"
+	"testing"
+)
+
+func TestImplementations(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+import "io"
+
+type Plugin interface {
+	Name() string
+}
+
+type ValuePlugin struct{}
+
+func (ValuePlugin) Name() string { return "value" }
+
+type PointerPlugin struct{}
+
+func (*PointerPlugin) Name() string { return "pointer" }
+
+func (*PointerPlugin) Close() error { return nil }
+
+type Embedding struct {
+	ValuePlugin
+}
+
+type NotAPlugin struct{}
+
+type Generic[T any] struct{}
+
+func (Generic[T]) Name() string { return "generic" }
+
+type ReadPlugin interface {
+	Plugin
+	io.Reader
+}
+
+func local() {
+	type localPlugin struct{ ValuePlugin }
+}
+
+func otherLocal() {
+	type localPlugin struct{ ValuePlugin }
+}
+`)
+
+	var got []string
+	for _, impl := range pkg.ImplementationsOf(pkg.LookupType(pkg.Path() + ".Plugin")) {
+		// anything else the default loader loaded is included too
+		if impl.Type.Obj().Pkg() == pkg.TypesPkg {
+			got = append(got, impl.String())
+		}
+	}
+	expected := []string{
+		pkg.Path() + ".Embedding",
+		"*" + pkg.Path() + ".PointerPlugin",
+		pkg.Path() + ".ValuePlugin",
+		pkg.Path() + ".localPlugin",
+		pkg.Path() + ".localPlugin",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("got %q", got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("got %q", got)
+		}
+	}
+
+	// types of imported packages are considered too
+	var writers []string
+	for _, impl := range pkg.ImplementationsOf(pkg.LookupType("io.Reader")) {
+		writers = append(writers, impl.String())
+	}
+	if !contains(writers, "*io.PipeReader") || contains(writers, "io.PipeReader") {
+		t.Errorf("got %q", writers)
+	}
+
+	pointerPlugin := pkg.LookupType(pkg.Path() + ".PointerPlugin")
+
+	var names []string
+	for _, iface := range pkg.InterfacesSatisfiedBy(types.NewPointer(pointerPlugin)) {
+		names = append(names, iface.String())
+	}
+	if !contains(names, pkg.Path()+".Plugin") || !contains(names, "io.Closer") || contains(names, pkg.Path()+".ReadPlugin") {
+		t.Errorf("got %q", names)
+	}
+
+	if ifaces := pkg.InterfacesSatisfiedBy(pointerPlugin); len(ifaces) != 0 {
+		t.Errorf("got %v", ifaces)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	pkg.ImplementationsOf(pointerPlugin)
+}
@@ -4,23 +4,15 @@
 package stan
 
 import (
-	"go/build"
-	"go/token"
 	"go/types"
 )
 
-var (
-	imports = make(map[string]*types.Package)
-	fset    = token.NewFileSet()
-	imp     = newSrcImporter(&build.Default, fset, imports)
-)
-
 type dirOverrideImporter struct {
 	types.ImporterFrom
 	dirs map[string]string
 }
 
-func importerWithDirOverride(dirs map[string]string) types.ImporterFrom {
+func importerWithDirOverride(imp types.ImporterFrom, dirs map[string]string) types.ImporterFrom {
 	return dirOverrideImporter{ImporterFrom: imp, dirs: dirs}
 }
 
@@ -30,3 +22,21 @@ func (i dirOverrideImporter) ImportFrom(path, srcDir string, mode types.ImportMo
 	}
 	return i.ImporterFrom.ImportFrom(path, srcDir, mode)
 }
+
+// fakeImporter imports packages from fakes before falling back to the
+// wrapped importer.
+type fakeImporter struct {
+	types.ImporterFrom
+	fakes map[string]*types.Package
+}
+
+func (i fakeImporter) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, "", 0)
+}
+
+func (i fakeImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if pkg := i.fakes[path]; pkg != nil {
+		return pkg, nil
+	}
+	return i.ImporterFrom.ImportFrom(path, srcDir, mode)
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/build"
+	"go/token"
+	"go/types"
+	"strings"
+	"sync"
+)
+
+// Loader finds, parses and type checks packages for a single build
+// configuration. Each Loader has its own file set and caches, so the same
+// code can be loaded for several configurations in one process:
+//
+//	ctxt := build.Default
+//	ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled = "windows", "arm64", false
+//	winPkgs := (&stan.Loader{Context: ctxt}).Pkgs("your/namespace/...")
+//
+// Configure a Loader before its first use; changing the fields afterwards
+// has no effect. Pkgs(), LoadPkgs() and EvalPkg() use a default Loader based
+// on build.Default and the working directory.
+type Loader struct {
+	// Build context controlling GOOS, GOARCH, build tags, GOROOT, GOPATH and
+	// whether cgo files are processed (CgoEnabled). The zero value is not
+	// useful, start from build.Default.
+	Context build.Context
+
+	// Directory local patterns are relative to and where the enclosing
+	// module is looked for. Defaults to the working directory.
+	Dir string
+
+	// If set, each package is type checked separately for every distinct
+	// set of files buildable under these configurations instead of
+	// renaming colliding objects in non-buildable files. See BuildConfig.
+	BuildConfigs []BuildConfig
+
+	// File contents, keyed by absolute file name, to use instead of what is
+	// on disk. Overlaid files are added to their directory if they don't
+	// exist, and are seen by the importer too. Directories only present in
+	// the overlay can be loaded by name, but aren't matched by "..."
+	// wildcards. Overlaid cgo files are not supported.
+	Overlay map[string][]byte
+
+	// If set, export data of packages the importer type checks from source
+	// is cached in this directory and reused by later runs (and other
+	// Loaders) as long as the package's files, its dependencies, the build
+	// configuration and the Go version are unchanged. Packages named in
+	// Pkgs() are always type checked from source. Changes to C headers used
+	// by cgo packages are not detected. See DefaultCacheDir().
+	CacheDir string
+
+	// Maximum number of packages type checked concurrently. Defaults to
+	// runtime.GOMAXPROCS(0).
+	Parallelism int
+
+	initOnce sync.Once
+
+	// serializes loading
+	mu sync.Mutex
+
+	fset          *token.FileSet
+	overlay       overlay
+	modules       *moduleResolver
+	imp           *srcImporter
+	packagesCache map[string][]*Package
+
+	variantsMu sync.Mutex
+	variants   map[string]*Loader
+
+	// facts of analysis.Analyzers, see RunAnalyzer()
+	factsMu sync.Mutex
+	facts   *analysisFacts
+}
+
+// NewLoader returns a Loader for build context ctxt.
+func NewLoader(ctxt build.Context) *Loader {
+	return &Loader{Context: ctxt}
+}
+
+var defaultLoader = NewLoader(build.Default)
+
+func (l *Loader) init() {
+	l.initOnce.Do(func() {
+		if l.fset == nil {
+			l.fset = token.NewFileSet()
+		}
+		l.overlay = newOverlay(l.Overlay)
+		l.reset()
+	})
+}
+
+// reset (re)creates l's caches.
+func (l *Loader) reset() {
+	l.modules = newModuleResolver(&l.Context, l.Dir)
+
+	l.imp = l.newImporter(l.fset, make(map[string]*types.Package), l.CacheDir)
+	l.packagesCache = make(map[string][]*Package)
+
+	l.variantsMu.Lock()
+	l.variants = make(map[string]*Loader)
+	l.variantsMu.Unlock()
+
+	l.dropAnalysisFacts()
+}
+
+// newImporter returns an importer of packages as l sees them, starting out
+// with packages. The export cache in cacheDir is disabled if it is empty.
+func (l *Loader) newImporter(fset *token.FileSet, packages map[string]*types.Package, cacheDir string) *srcImporter {
+	importCtxt := l.Context
+	l.overlay.apply(&importCtxt)
+	return newSrcImporter(&importCtxt, fset, packages, l.modules, cacheDir)
+}
+
+// Invalidate() drops pkgPaths and every package transitively importing them
+// from the default Loader's caches. See Loader.Invalidate().
+func Invalidate(pkgPaths ...string) {
+	defaultLoader.Invalidate(pkgPaths...)
+}
+
+// ReloadPkgs() invalidates and then loads pkgPaths using the default Loader.
+// See Loader.ReloadPkgs().
+func ReloadPkgs(pkgPaths ...string) ([]*Package, error) {
+	return defaultLoader.ReloadPkgs(pkgPaths...)
+}
+
+// Reset() clears all of the default Loader's caches. See Loader.Reset().
+func Reset() {
+	defaultLoader.Reset()
+}
+
+// Invalidate() drops the packages named by pkgPaths from l's caches, along
+// with every cached package that transitively imports them, so they are
+// parsed and type checked again the next time they are needed. pkgPaths can
+// be import paths or the patterns they were loaded with; "..." patterns
+// match any known import path. Packages returned before Invalidate() are not
+// updated; load them again to see changes.
+func (l *Loader) Invalidate(pkgPaths ...string) {
+	l.init()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.invalidate(pkgPaths)
+}
+
+// ReloadPkgs() is like LoadPkgs(), but first invalidates pkgPaths so changes
+// on disk (or in Overlay) are picked up.
+func (l *Loader) ReloadPkgs(pkgPaths ...string) ([]*Package, error) {
+	l.Invalidate(pkgPaths...)
+	return l.LoadPkgs(pkgPaths...)
+}
+
+// Reset() clears all of l's caches, including the module information read
+// from go.mod files. Packages returned before Reset() are not updated.
+func (l *Loader) Reset() {
+	l.init()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fset = token.NewFileSet()
+	l.reset()
+}
+
+func (l *Loader) invalidate(pkgPaths []string) {
+	// reverse import graph of every package we know about
+	importedBy := make(map[string][]string)
+	addImports := func(tPkg *types.Package) {
+		for _, imp := range tPkg.Imports() {
+			importedBy[imp.Path()] = append(importedBy[imp.Path()], tPkg.Path())
+		}
+	}
+	imported := l.imp.imported()
+	for _, tPkg := range imported {
+		addImports(tPkg)
+	}
+	for _, pkgs := range l.packagesCache {
+		for _, pkg := range pkgs {
+			addImports(pkg.TypesPkg)
+		}
+	}
+
+	var (
+		stale = make(map[string]bool)
+		queue []string
+	)
+	markStale := func(path string) {
+		if !stale[path] {
+			stale[path] = true
+			queue = append(queue, path)
+		}
+	}
+
+	for _, pattern := range pkgPaths {
+		markStale(pattern)
+
+		for _, pkg := range l.packagesCache[pattern] {
+			markStale(pkg.Path())
+		}
+
+		if strings.Contains(pattern, "...") {
+			match := matchPattern(pattern)
+			for _, tPkg := range imported {
+				if match(tPkg.Path()) {
+					markStale(tPkg.Path())
+				}
+			}
+			for _, pkgs := range l.packagesCache {
+				for _, pkg := range pkgs {
+					if match(pkg.Path()) {
+						markStale(pkg.Path())
+					}
+				}
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, importer := range importedBy[path] {
+			markStale(importer)
+		}
+	}
+
+	for path := range stale {
+		l.imp.forget(path)
+	}
+	l.dropAnalysisFacts()
+
+	// drop cached patterns that yielded a stale package
+	for key, pkgs := range l.packagesCache {
+		if stale[key] {
+			delete(l.packagesCache, key)
+			continue
+		}
+		for _, pkg := range pkgs {
+			if stale[pkg.Path()] {
+				delete(l.packagesCache, key)
+				break
+			}
+		}
+	}
+
+	l.variantsMu.Lock()
+	defer l.variantsMu.Unlock()
+
+	var stalePaths []string
+	for path := range stale {
+		stalePaths = append(stalePaths, path)
+	}
+	for _, v := range l.variants {
+		v.invalidate(stalePaths)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/build"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoaderPlatforms(t *testing.T) {
+	isPointerRecv := func(l *Loader) bool {
+		bar := l.Pkgs("github.com/retailnext/stan/internal/bar")[0]
+		someMethod := bar.LookupObject("github.com/retailnext/stan/internal/bar.BarType.someMethod")
+		_, isPtr := someMethod.Type().(*types.Signature).Recv().Type().(*types.Pointer)
+		return isPtr
+	}
+
+	for _, tc := range []struct {
+		goos, goarch string
+		ptr          bool
+	}{
+		{"linux", "amd64", false},
+		{"windows", "arm64", false},
+		{"darwin", "amd64", true},
+	} {
+		ctxt := build.Default
+		ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled = tc.goos, tc.goarch, false
+
+		l := NewLoader(ctxt)
+		if got := isPointerRecv(l); got != tc.ptr {
+			t.Errorf("%s/%s: expected pointer receiver %t", tc.goos, tc.goarch, tc.ptr)
+		}
+	}
+
+	// separate loaders don't share packages
+	ctxt := build.Default
+	ctxt.CgoEnabled = false
+	l1, l2 := NewLoader(ctxt), NewLoader(ctxt)
+	if l1.Pkgs("github.com/retailnext/stan/internal/bar")[0] == l2.Pkgs("github.com/retailnext/stan/internal/bar")[0] {
+		t.Error("expected distinct packages")
+	}
+}
+
+func TestLoaderDir(t *testing.T) {
+	l := NewLoader(build.Default)
+	l.Dir = filepath.Join("testdata", "mod")
+
+	var got []string
+	for _, pkg := range l.Pkgs("./...") {
+		got = append(got, pkg.Path())
+	}
+
+	if len(got) != 2 || got[0] != "example.com/mod" || got[1] != "example.com/mod/sub" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestLoaderInvalidate(t *testing.T) {
+	dir := writeModule(t, "example.com/reload", map[string]string{
+		"a/a.go": "package a\n\ntype T int\n",
+		"b/b.go": "package b\n\nimport \"example.com/reload/a\"\n\nvar V a.T\n",
+		"c/c.go": "package c\n\nvar W int\n",
+	})
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+
+	underlyingOfV := func() string {
+		b := l.Pkgs("example.com/reload/b")[0]
+		return b.LookupObject("example.com/reload/b.V").Type().Underlying().String()
+	}
+
+	all := l.Pkgs("./...")
+	c := all[2]
+	if got := underlyingOfV(); got != "int" {
+		t.Fatalf("got %s", got)
+	}
+
+	writeFiles(t, dir, map[string]string{"a/a.go": "package a\n\ntype T string\n"})
+
+	// still cached
+	if got := underlyingOfV(); got != "int" {
+		t.Errorf("got %s", got)
+	}
+
+	l.Invalidate("example.com/reload/a")
+
+	// b imports a, so it is reloaded too
+	if got := underlyingOfV(); got != "string" {
+		t.Errorf("got %s", got)
+	}
+
+	// c doesn't import a
+	if l.Pkgs("example.com/reload/c")[0] != c {
+		t.Error("expected c to stay cached")
+	}
+
+	// pattern yielding a was dropped
+	if l.Pkgs("./...")[0] == all[0] {
+		t.Error("expected ./... to be reloaded")
+	}
+
+	writeFiles(t, dir, map[string]string{"a/a.go": "package a\n\ntype T bool\n"})
+
+	pkgs, err := l.ReloadPkgs("./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := underlyingOfV(); got != "bool" {
+		t.Errorf("got %s", got)
+	}
+	if pkgs[2] == c {
+		t.Error("expected c to be reloaded")
+	}
+
+	l.Reset()
+	if l.Pkgs("example.com/reload/c")[0] == pkgs[2] {
+		t.Error("expected c to be reloaded")
+	}
+}
+
+// writeModule writes a go.mod for module and files, keyed by slash separated
+// path, to a new temporary directory and returns the directory, which is
+// removed when t finishes.
+func writeModule(t *testing.T, module string, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "stan_module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeFiles(t, dir, map[string]string{"go.mod": "module " + module + "\n"})
+	writeFiles(t, dir, files)
+	return dir
+}
+
+// writeFiles writes files, keyed by slash separated path, under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, src := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoaderParallel(t *testing.T) {
+	l := NewLoader(build.Default)
+	l.init()
+
+	// concurrent imports of overlapping dependencies share packages
+	var (
+		paths = []string{"text/template", "encoding/json", "text/template", "bufio", "encoding/json"}
+		got   = make([]*types.Package, len(paths))
+		wg    sync.WaitGroup
+	)
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			pkg, err := l.imp.Import(path)
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] = pkg
+		}(i, path)
+	}
+	wg.Wait()
+
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	if got[0] != got[2] || got[1] != got[4] {
+		t.Error("expected identical packages")
+	}
+
+	ioPkgs := make(map[*types.Package]bool)
+	for _, pkg := range got {
+		for _, imp := range pkg.Imports() {
+			if imp.Path() == "io" {
+				ioPkgs[imp] = true
+			}
+		}
+	}
+	if len(ioPkgs) != 1 {
+		t.Errorf("expected a single io package, got %d", len(ioPkgs))
+	}
+
+	// results don't depend on the parallelism
+	var orders [][]string
+	for _, parallelism := range []int{1, 4} {
+		l := NewLoader(build.Default)
+		l.Parallelism = parallelism
+
+		var order []string
+		for _, pkg := range l.Pkgs("github.com/retailnext/stan/internal/...") {
+			order = append(order, pkg.Path())
+		}
+		orders = append(orders, order)
+	}
+	if strings.Join(orders[0], ",") != strings.Join(orders[1], ",") {
+		t.Errorf("got %v", orders)
+	}
+}
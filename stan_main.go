@@ -0,0 +1,238 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of Main().
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitFailure  = 2
+)
+
+// Main() is the entry point of a stan command running checks, or all
+// registered checks if none are given. Build your own command with your
+// checks:
+//
+//	package main
+//
+//	func main() {
+//	  stan.Main(TimeEqual, CSVWriterError)
+//	}
+//
+// and run it like "yourstan [flags] your/namespace/...". Run it with -help
+// for the flags. Main() exits with status 1 if there were error severity
+// diagnostics and 2 if packages failed to load.
+func Main(checks ...*Check) {
+	if len(checks) == 0 {
+		checks = Checks()
+	}
+	os.Exit(runMain(os.Args[0], os.Args[1:], os.Stdout, os.Stderr, checks))
+}
+
+func runMain(name string, args []string, stdout, stderr io.Writer, checks []*Check) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var (
+		selected = flags.String("checks", "", "comma separated names or globs of the checks to run; prefix with - to exclude (default all)")
+		format   = flags.String("format", "text", "output format: text, "+strings.Join(ReportFormats, ", "))
+		fix      = flags.Bool("fix", false, "apply suggested fixes")
+		diff     = flags.Bool("diff", false, "print suggested fixes as a unified diff instead of reporting diagnostics")
+		list     = flags.Bool("list", false, "list the checks and exit")
+		dir      = flags.String("C", "", "change to `dir` before loading packages")
+		tags     = flags.String("tags", "", "comma separated build tags")
+		changed  = flags.String("changed", "", "only report diagnostics on lines changed by the unified diff in `file` (- for stdin), e.g. from git diff")
+		funcs    = flags.Bool("changed-funcs", false, "with -changed, report diagnostics anywhere in changed functions")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [flags] [packages]\n\nRuns static checks on packages (default \".\").\n\nFlags:\n", name)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitFailure
+	}
+
+	checks, err := selectChecks(checks, *selected)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	if *list {
+		tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		for _, c := range checks {
+			fmt.Fprintf(tw, "%s\t%s\n", c.Name, strings.SplitN(c.Doc, "\n", 2)[0])
+		}
+		tw.Flush()
+		return exitOK
+	}
+
+	validFormat := *format == "text"
+	for _, f := range ReportFormats {
+		validFormat = validFormat || f == *format
+	}
+	if !validFormat {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return exitFailure
+	}
+
+	var changes *Changes
+	if *changed != "" {
+		if changes, err = ReadChanges(*changed); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		changes.Root = RepoRoot(*dir)
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	ctxt := build.Default
+	if *tags != "" {
+		ctxt.BuildTags = append(append([]string(nil), ctxt.BuildTags...), strings.Split(*tags, ",")...)
+	}
+	l := NewLoader(ctxt)
+	l.Dir = *dir
+
+	status := exitOK
+
+	pkgs, err := l.LoadPkgs(patterns...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		status = exitFailure
+	}
+
+	var diags []Diagnostic
+	for _, pkg := range pkgs {
+		diags = append(diags, RunChecks(pkg, checks...)...)
+	}
+
+	if changes != nil {
+		if *funcs {
+			changes = changes.Widen(pkgs...)
+		}
+		diags = changes.Filter(diags)
+	}
+
+	for _, d := range diags {
+		if d.Severity == SeverityError && status == exitOK {
+			status = exitFindings
+		}
+	}
+
+	if *diff {
+		if _, err := ApplyFixes(diags, FixDiff, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		return status
+	}
+
+	root := RepoRoot(*dir)
+	if *format == "text" {
+		wd, _ := os.Getwd()
+		for _, d := range diags {
+			d.Pos.Filename = relPath(wd, d.Pos.Filename)
+			fmt.Fprintln(stdout, d)
+		}
+	} else {
+		r := &Report{Diagnostics: diags, Checks: checks, Root: root}
+		if err := r.Write(stdout, *format); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+
+	if *fix {
+		changed, err := ApplyFixes(diags, FixWrite, nil)
+		for _, name := range changed {
+			fmt.Fprintf(stderr, "fixed %s\n", filepath.ToSlash(name))
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+	}
+
+	return status
+}
+
+// selectChecks returns the checks matching spec, a comma separated list of
+// names or path.Match() globs. Patterns prefixed with "-" exclude checks.
+// An empty spec, or one with only exclusions, starts from all checks.
+func selectChecks(checks []*Check, spec string) ([]*Check, error) {
+	if spec == "" {
+		return checks, nil
+	}
+
+	var include, exclude []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		exclusion := strings.HasPrefix(pattern, "-")
+		pattern = strings.TrimPrefix(pattern, "-")
+
+		matched := false
+		for _, c := range checks {
+			ok, err := path.Match(pattern, c.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid check pattern %q: %s", pattern, err)
+			}
+			matched = matched || ok
+		}
+		if !matched {
+			return nil, fmt.Errorf("no check matches %q", pattern)
+		}
+
+		if exclusion {
+			exclude = append(exclude, pattern)
+		} else {
+			include = append(include, pattern)
+		}
+	}
+
+	matchesAny := func(name string, patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ret []*Check
+	for _, c := range checks {
+		if len(include) > 0 && !matchesAny(c.Name, include) {
+			continue
+		}
+		if matchesAny(c.Name, exclude) {
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMainCommand(t *testing.T) {
+	dir := writeModule(t, "example.com/fix", map[string]string{"fix.go": timeEqualSrc})
+
+	checks := []*Check{timeEqualCheck, noBadCheck}
+
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		status := runMain("stan", append([]string{"-C", dir}, args...), &stdout, &stderr, checks)
+		return status, stdout.String(), stderr.String()
+	}
+
+	status, out, _ := run("-list")
+	if status != 0 || !strings.HasPrefix(out, "timeequal  \nnobad      don't name things bad\n") {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, out, _ = run("-list", "-checks", "no*")
+	if status != 0 || strings.Contains(out, "timeequal") {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, _, errOut := run("-checks", "missing", ".")
+	if status != 2 || !strings.Contains(errOut, `no check matches "missing"`) {
+		t.Errorf("got %d, %q", status, errOut)
+	}
+
+	status, out, _ = run("-checks", "-timeequal")
+	if status != 0 || out != "" {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, out, _ = run("-format", "json", "./...")
+	if status != 1 || strings.Count(out, `"check":"timeequal"`) != 2 {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, out, _ = run("-diff")
+	if status != 1 || !strings.Contains(out, "+\treturn a.Equal(b)\n") {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	// only SameAsNow's signature changed
+	diffFile := filepath.Join(dir, "changes.diff")
+	if err := ioutil.WriteFile(diffFile, []byte("--- a/fix.go\n+++ b/fix.go\n@@ -9 +9 @@\n-func SameAsNow(t time.Time) bool {\n+func SameAsNow(a time.Time) bool {\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out, _ = run("-changed", diffFile)
+	if status != 0 || out != "" {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, out, _ = run("-changed", diffFile, "-changed-funcs")
+	if status != 1 || strings.Count(out, "(timeequal)\n") != 1 || !strings.Contains(out, "fix.go:10:") {
+		t.Errorf("got %d, %q", status, out)
+	}
+
+	status, out, errOut = run("-fix")
+	if status != 1 || strings.Count(out, "(timeequal)\n") != 2 || !strings.HasPrefix(errOut, "fixed ") {
+		t.Errorf("got %d, %q, %q", status, out, errOut)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(dir, "fix.go")); string(got) != timeEqualFixed {
+		t.Errorf("got:\n%s", got)
+	}
+
+	status, _, errOut = run("example.com/missing")
+	if status != 2 || errOut == "" {
+		t.Errorf("got %d, %q", status, errOut)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// goModule is a module as described by its go.mod file.
+type goModule struct {
+	// module path from the "module" directive
+	path string
+	// directory containing go.mod
+	dir string
+	// dependencies, sorted longest path first so the first prefix match
+	// is the most specific module
+	deps []moduleDep
+}
+
+type moduleDep struct {
+	path string
+	dir  string
+}
+
+// dirFor returns the directory holding the package importPath according to
+// m's main module, vendor directory and requirements.
+func (m *goModule) dirFor(importPath string) (string, bool) {
+	if hasPathPrefix(importPath, m.path) {
+		return filepath.Join(m.dir, filepath.FromSlash(importPath[len(m.path):])), true
+	}
+
+	for _, dep := range m.deps {
+		if hasPathPrefix(importPath, dep.path) {
+			return filepath.Join(dep.dir, filepath.FromSlash(importPath[len(dep.path):])), true
+		}
+	}
+
+	return "", false
+}
+
+// importPathFor returns the import path of directory dir within m.
+func (m *goModule) importPathFor(dir string) (string, bool) {
+	rel, err := filepath.Rel(m.dir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return m.path, true
+	}
+	return m.path + "/" + filepath.ToSlash(rel), true
+}
+
+func parseGoMod(dir string, ctxt *build.Context) (*goModule, error) {
+	gomod := filepath.Join(dir, "go.mod")
+
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Module == nil {
+		return nil, fmt.Errorf("%s has no module directive", gomod)
+	}
+
+	m := &goModule{
+		path: f.Module.Mod.Path,
+		dir:  dir,
+	}
+
+	vendor := useVendor(dir)
+	cacheDir := moduleCacheDir(ctxt)
+
+	replaced := make(map[string]module.Version)
+	for _, r := range f.Replace {
+		if r.Old.Version == "" {
+			replaced[r.Old.Path] = r.New
+		} else {
+			replaced[r.Old.Path+"@"+r.Old.Version] = r.New
+		}
+	}
+
+	for _, req := range f.Require {
+		dep := moduleDep{path: req.Mod.Path}
+
+		if vendor {
+			dep.dir = filepath.Join(dir, "vendor", filepath.FromSlash(req.Mod.Path))
+			m.deps = append(m.deps, dep)
+			continue
+		}
+
+		mod := req.Mod
+		if r, ok := replaced[mod.Path+"@"+mod.Version]; ok {
+			mod = r
+		} else if r, ok := replaced[mod.Path]; ok {
+			mod = r
+		}
+
+		if mod.Version == "" {
+			// replaced with a local directory
+			if filepath.IsAbs(mod.Path) {
+				dep.dir = mod.Path
+			} else {
+				dep.dir = filepath.Join(dir, filepath.FromSlash(mod.Path))
+			}
+		} else {
+			escPath, err := module.EscapePath(mod.Path)
+			if err != nil {
+				return nil, err
+			}
+			escVersion, err := module.EscapeVersion(mod.Version)
+			if err != nil {
+				return nil, err
+			}
+			dep.dir = filepath.Join(cacheDir, escPath+"@"+escVersion)
+		}
+
+		m.deps = append(m.deps, dep)
+	}
+
+	sort.Slice(m.deps, func(i, j int) bool {
+		return len(m.deps[i].path) > len(m.deps[j].path)
+	})
+
+	return m, nil
+}
+
+// useVendor reports whether the go command would use the vendor directory of
+// the module rooted at dir.
+func useVendor(dir string) bool {
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		switch flag {
+		case "-mod=mod", "-mod=readonly":
+			return false
+		case "-mod=vendor":
+			return true
+		}
+	}
+
+	_, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt"))
+	return err == nil
+}
+
+func moduleCacheDir(ctxt *build.Context) string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(ctxt.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// isStandardImportPath reports whether path looks like a standard library
+// package (based on cmd/go/internal/search.IsStandardImportPath).
+func isStandardImportPath(path string) bool {
+	i := strings.Index(path, "/")
+	if i < 0 {
+		i = len(path)
+	}
+	return !strings.Contains(path[:i], ".")
+}
+
+// moduleResolver locates go.mod files and resolves import paths to
+// directories the same way the go command does in module mode.
+type moduleResolver struct {
+	ctxt *build.Context
+	// working directory, os.Getwd() if empty
+	wd string
+
+	mu      sync.Mutex
+	modules map[string]*goModule
+}
+
+func newModuleResolver(ctxt *build.Context, wd string) *moduleResolver {
+	return &moduleResolver{
+		ctxt:    ctxt,
+		wd:      wd,
+		modules: make(map[string]*goModule),
+	}
+}
+
+func (r *moduleResolver) getwd() (string, error) {
+	if r.wd != "" {
+		return filepath.Abs(r.wd)
+	}
+	return os.Getwd()
+}
+
+func (r *moduleResolver) enabled() bool {
+	return os.Getenv("GO111MODULE") != "off"
+}
+
+// moduleFor returns the module enclosing dir, or nil if dir is not inside a
+// module. An empty dir means the resolver's working directory. Directories
+// within the module cache resolve against the module enclosing the working
+// directory, since that module's requirements decide the versions of every
+// dependency.
+func (r *moduleResolver) moduleFor(dir string) (*goModule, error) {
+	if !r.enabled() {
+		return nil, nil
+	}
+
+	var err error
+	if dir == "" {
+		dir, err = r.getwd()
+	} else {
+		dir, err = filepath.Abs(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheDir := moduleCacheDir(r.ctxt); cacheDir != "" && hasFilePathPrefix(dir, cacheDir) {
+		wd, err := r.getwd()
+		if err != nil {
+			return nil, err
+		}
+		if main, err := r.moduleFor(wd); main != nil || err != nil {
+			return main, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var visited []string
+	defer func() {
+		// remember answer for intermediate directories too
+		m := r.modules[dir]
+		for _, v := range visited {
+			r.modules[v] = m
+		}
+	}()
+
+	for {
+		if m, found := r.modules[dir]; found {
+			return m, nil
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			m, err := parseGoMod(dir, r.ctxt)
+			if err != nil {
+				return nil, err
+			}
+			r.modules[dir] = m
+			return m, nil
+		}
+
+		visited = append(visited, dir)
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			r.modules[dir] = nil
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// importDir resolves importPath, as imported from srcDir, to a directory
+// using the module enclosing srcDir. found is false if no module applies
+// (e.g. GOPATH mode or standard library packages).
+func (r *moduleResolver) importDir(importPath, srcDir string) (dir string, found bool, err error) {
+	m, err := r.moduleFor(srcDir)
+	if err != nil || m == nil {
+		return "", false, err
+	}
+
+	if !hasPathPrefix(importPath, m.path) && isStandardImportPath(importPath) {
+		return "", false, nil
+	}
+
+	dir, found = m.dirFor(importPath)
+	return dir, found, nil
+}
+
+func hasFilePathPrefix(s, prefix string) bool {
+	prefix = filepath.Clean(prefix)
+	return s == prefix || strings.HasPrefix(s, prefix+string(filepath.Separator))
+}
+
+// moduleImportPath returns the import path of the package in directory dir,
+// which may be relative to the process's working directory.
+func moduleImportPath(m *goModule, dir string) (string, bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	return m.importPathFor(abs)
+}
+
+func isModuleRoot(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil && !fi.IsDir()
+}
+
+// srcRoot is a directory tree of packages whose import paths are importPrefix
+// joined with the directory's path relative to dir.
+type srcRoot struct {
+	dir          string
+	importPrefix string
+}
+
+// srcRoots returns the directory trees searched for packages matching
+// wildcard patterns. In module mode that is the standard library, the main
+// module and its requirements, otherwise it is l.Context.SrcDirs().
+func (l *Loader) srcRoots() ([]srcRoot, error) {
+	var roots []srcRoot
+
+	mod, err := l.modules.moduleFor("")
+	if err != nil {
+		return nil, err
+	}
+
+	if mod == nil {
+		for _, src := range l.Context.SrcDirs() {
+			roots = append(roots, srcRoot{dir: src})
+		}
+		return roots, nil
+	}
+
+	roots = append(roots,
+		srcRoot{dir: filepath.Join(l.Context.GOROOT, "src")},
+		srcRoot{dir: mod.dir, importPrefix: mod.path},
+	)
+	for _, dep := range mod.deps {
+		roots = append(roots, srcRoot{dir: dep.dir, importPrefix: dep.path})
+	}
+
+	return roots, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModulePkgs(t *testing.T) {
+	pkgs := Pkgs("./testdata/mod/...")
+
+	var got []string
+	for _, pkg := range pkgs {
+		got = append(got, pkg.Path())
+	}
+
+	if len(got) != 2 || got[0] != "example.com/mod" || got[1] != "example.com/mod/sub" {
+		t.Fatalf("got %v", got)
+	}
+
+	// dependency resolved through replace directive
+	modVar := pkgs[0].LookupObject("example.com/mod.ModVar")
+	if ts := modVar.Type().String(); ts != "example.com/dep.DepType" {
+		t.Errorf("got %s", ts)
+	}
+
+	if !pkgs[1].TypesPkg.Imports()[0].Complete() {
+		t.Errorf("example.com/mod not imported")
+	}
+}
+
+func TestModulePkgsFromModuleRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join("testdata", "mod")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pkgs := Pkgs("example.com/mod/...")
+	if len(pkgs) != 2 {
+		t.Fatalf("got %v", pkgs)
+	}
+
+	if p := Pkgs("example.com/dep")[0].Path(); p != "example.com/dep" {
+		t.Errorf("got %s", p)
+	}
+}
+
+func TestModuleVendor(t *testing.T) {
+	defer os.Setenv("GOFLAGS", os.Getenv("GOFLAGS"))
+	os.Setenv("GOFLAGS", "")
+
+	pkg := Pkgs("./testdata/modvendor")[0]
+
+	if p := pkg.Path(); p != "example.com/modvendor" {
+		t.Errorf("got %s", p)
+	}
+
+	vendorVar := pkg.LookupObject("example.com/modvendor.VendorVar")
+	if ts := vendorVar.Type().String(); ts != "example.com/vendored.VendoredType" {
+		t.Errorf("got %s", ts)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// overlay maps absolute file names to contents that replace the file on
+// disk, or add a file if there is none.
+type overlay map[string][]byte
+
+func newOverlay(files map[string][]byte) overlay {
+	if len(files) == 0 {
+		return nil
+	}
+
+	o := make(overlay, len(files))
+	for name, contents := range files {
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+		o[name] = contents
+	}
+	return o
+}
+
+func (o overlay) lookup(name string) ([]byte, bool) {
+	if len(o) == 0 {
+		return nil, false
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	contents, found := o[name]
+	return contents, found
+}
+
+func (o overlay) readFile(name string) ([]byte, error) {
+	if contents, found := o.lookup(name); found {
+		return contents, nil
+	}
+	return ioutil.ReadFile(name)
+}
+
+func (o overlay) openFile(name string) (io.ReadCloser, error) {
+	if contents, found := o.lookup(name); found {
+		return ioutil.NopCloser(bytes.NewReader(contents)), nil
+	}
+	return os.Open(name)
+}
+
+// readDir lists dir on disk along with any overlaid files in dir. dir need
+// not exist on disk if it contains overlaid files.
+func (o overlay) readDir(dir string) ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if len(o) == 0 {
+		return entries, err
+	}
+
+	absDir, absErr := filepath.Abs(dir)
+	if absErr != nil {
+		return entries, err
+	}
+
+	byName := make(map[string]os.FileInfo)
+	for _, entry := range entries {
+		byName[entry.Name()] = entry
+	}
+
+	var found bool
+	for name, contents := range o {
+		if filepath.Dir(name) == absDir {
+			found = true
+			byName[filepath.Base(name)] = overlayFileInfo{name: filepath.Base(name), size: int64(len(contents))}
+		}
+	}
+
+	if !found {
+		return entries, err
+	}
+
+	entries = entries[:0]
+	for _, entry := range byName {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// isDir reports whether dir exists on disk or contains overlaid files.
+func (o overlay) isDir(dir string) bool {
+	if fi, err := os.Stat(dir); err == nil {
+		return fi.IsDir()
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for name := range o {
+		if strings.HasPrefix(name, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply makes ctxt's file system operations honor o.
+func (o overlay) apply(ctxt *build.Context) {
+	if len(o) == 0 {
+		return
+	}
+	ctxt.OpenFile = o.openFile
+	ctxt.ReadDir = o.readDir
+	ctxt.IsDir = o.isDir
+}
+
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayFileInfo) Name() string       { return fi.name }
+func (fi overlayFileInfo) Size() int64        { return fi.size }
+func (fi overlayFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayFileInfo) IsDir() bool        { return false }
+func (fi overlayFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,71 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/build"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	fooDir, err := filepath.Abs(filepath.Join("internal", "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	barDir := filepath.Join(filepath.Dir(fooDir), "bar")
+	virtualDir := filepath.Join(filepath.Dir(fooDir), "virtual")
+
+	l := NewLoader(build.Default)
+	l.Overlay = map[string][]byte{
+		// replaces file on disk
+		filepath.Join(barDir, "bar.go"): []byte(`package bar
+
+type BarType string
+
+var BarVar BarType
+
+func BarFunc() BarType {
+	return BarVar
+}
+
+func OverlayFunc() int {
+	return 123
+}
+`),
+		// new file in existing package, using overlaid API from importer
+		filepath.Join(fooDir, "foo_overlay.go"): []byte(`package foo
+
+import "github.com/retailnext/stan/internal/bar"
+
+var overlayVar = bar.OverlayFunc()
+`),
+		// package that only exists in the overlay
+		filepath.Join(virtualDir, "virtual.go"): []byte(`package virtual
+
+import "github.com/retailnext/stan/internal/bar"
+
+var VirtualVar = bar.OverlayFunc()
+`),
+	}
+
+	foo := l.Pkgs("github.com/retailnext/stan/internal/foo")[0]
+
+	if _, found := foo.Files()[filepath.Join(fooDir, "foo_overlay.go")]; !found {
+		t.Error("overlay file not in package")
+	}
+
+	overlayVar := foo.LookupObject("github.com/retailnext/stan/internal/foo.overlayVar")
+	if ts := overlayVar.Type().String(); ts != "int" {
+		t.Errorf("got %s", ts)
+	}
+
+	virtual := l.Pkgs("github.com/retailnext/stan/internal/virtual")[0]
+	virtual.LookupObject("github.com/retailnext/stan/internal/virtual.VirtualVar")
+
+	// default loader is unaffected
+	if _, err := Pkgs("github.com/retailnext/stan/internal/bar")[0].TryLookupObject("github.com/retailnext/stan/internal/bar.OverlayFunc"); err == nil {
+		t.Error("overlay leaked into default loader")
+	}
+}
@@ -24,29 +24,49 @@ type parsedPackage struct {
 	buildFiles    []*ast.File
 	nonBuildFiles []*ast.File
 
+	// buildable files for each of Loader.BuildConfigs, if set
+	configFiles [][]*ast.File
+
 	path string
 	fset *token.FileSet
 }
 
-func findAndParse(paths []string) [][]*parsedPackage {
+// findAndParse returns the parsed packages and any errors for each of paths.
+// The results are indexed the same as paths.
+func (l *Loader) findAndParse(paths []string) ([][]*parsedPackage, []LoadErrors) {
+	l.init()
+
 	var (
-		wildcard []string
-		ret      [][]*parsedPackage
+		wildcard    []string
+		wildcardIdx []int
+		ret         = make([][]*parsedPackage, len(paths))
+		errs        = make([]LoadErrors, len(paths))
 	)
 
-	for _, p := range paths {
+	for i, p := range paths {
 		if strings.Contains(p, "...") {
 			if build.IsLocalImport(p) {
-				ret = append(ret, findAndParseWildcardLocal(p))
+				ret[i], errs[i] = l.findAndParseWildcardLocal(p)
 			} else {
 				wildcard = append(wildcard, p)
+				wildcardIdx = append(wildcardIdx, i)
 			}
 		} else {
-			ret = append(ret, []*parsedPackage{findAndParseSingle(p)})
+			pkg, err := l.findAndParseSingle(p)
+			if err != nil {
+				errs[i] = LoadErrors{err}
+			} else {
+				ret[i] = []*parsedPackage{pkg}
+			}
 		}
 	}
 
-	return append(ret, findAndParseWildcard(wildcard)...)
+	wildcardPkgs, wildcardErrs := l.findAndParseWildcard(wildcard)
+	for i, idx := range wildcardIdx {
+		ret[idx], errs[idx] = wildcardPkgs[i], wildcardErrs[i]
+	}
+
+	return ret, errs
 }
 
 type matcher = func(string) bool
@@ -61,9 +81,9 @@ func any(matchers []matcher, input string) bool {
 }
 
 // based on cmd/go/internal/load.MatchPackages
-func findAndParseWildcard(paths []string) [][]*parsedPackage {
+func (l *Loader) findAndParseWildcard(paths []string) ([][]*parsedPackage, []LoadErrors) {
 	if len(paths) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	match := make([]matcher, len(paths))
@@ -74,25 +94,47 @@ func findAndParseWildcard(paths []string) [][]*parsedPackage {
 	}
 
 	ret := make([][]*parsedPackage, len(paths))
+	errs := make([]LoadErrors, len(paths))
+
+	roots, err := l.srcRoots()
+	if err != nil {
+		for i, p := range paths {
+			errs[i] = LoadErrors{&PackageError{Path: p, Err: err}}
+		}
+		return ret, errs
+	}
 
 	have := make(map[string]bool)
 
-	for _, src := range build.Default.SrcDirs() {
-		src = filepath.Clean(src) + string(filepath.Separator)
+	for _, root := range roots {
+		src := filepath.Clean(root.dir)
 
 		filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
-			if err != nil || path == src {
+			if err != nil || path == src && root.importPrefix == "" {
 				return nil
 			}
 
 			want := true
 
-			_, elem := filepath.Split(path)
-			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
-				want = false
-			}
+			name := root.importPrefix
+			if path != src {
+				_, elem := filepath.Split(path)
+				if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
+					want = false
+				}
 
-			name := filepath.ToSlash(path[len(src):])
+				if root.importPrefix != "" && fi.IsDir() && (elem == "vendor" || isModuleRoot(path)) {
+					// vendored packages and nested modules are not part of this module
+					want = false
+				}
+
+				rel := filepath.ToSlash(path[len(src)+1:])
+				if name == "" {
+					name = rel
+				} else {
+					name += "/" + rel
+				}
+			}
 
 			if !any(treeCanMatch, name) {
 				want = false
@@ -115,9 +157,14 @@ func findAndParseWildcard(paths []string) [][]*parsedPackage {
 				return nil
 			}
 
-			parsed, err := parseDir(path, fset)
+			parsed, err := l.parseDir(path, l.fset)
 			if err != nil {
-				panic(fmt.Sprintf("error parsing %s: %s", path, err))
+				for i, m := range match {
+					if m(name) {
+						errs[i] = append(errs[i], newPackageError(name, err))
+					}
+				}
+				return nil
 			}
 
 			if parsed.code != nil {
@@ -149,11 +196,11 @@ func findAndParseWildcard(paths []string) [][]*parsedPackage {
 		})
 	}
 
-	return ret
+	return ret, errs
 }
 
 // based on cmd/go/internal/load.MatchPackagesInFS
-func findAndParseWildcardLocal(pattern string) []*parsedPackage {
+func (l *Loader) findAndParseWildcardLocal(pattern string) ([]*parsedPackage, LoadErrors) {
 
 	i := strings.Index(pattern, "...")
 	dir, _ := path.Split(pattern[:i])
@@ -164,13 +211,33 @@ func findAndParseWildcardLocal(pattern string) []*parsedPackage {
 	}
 	match := matchPattern(pattern)
 
-	var pkgs []*parsedPackage
-	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+	mod, err := l.modules.moduleFor(l.localDir(dir))
+	if err != nil {
+		return nil, LoadErrors{&PackageError{Path: pattern, Err: err}}
+	}
+
+	var (
+		pkgs []*parsedPackage
+		errs LoadErrors
+	)
+	root := l.localDir(dir)
+	filepath.Walk(root, func(dirPath string, fi os.FileInfo, err error) error {
 		if err != nil || !fi.IsDir() {
 			return nil
 		}
-		if path == dir {
-			path = filepath.Clean(path)
+
+		// path is relative to l.Dir, same as pattern
+		path := dirPath
+		if dirPath == root {
+			path = filepath.Clean(dir)
+		} else {
+			if l.Dir != "" {
+				path, _ = filepath.Rel(l.Dir, dirPath)
+			}
+			if mod != nil && (fi.Name() == "vendor" || isModuleRoot(dirPath)) {
+				// vendored packages and nested modules are not part of this module
+				return filepath.SkipDir
+			}
 		}
 
 		_, elem := filepath.Split(path)
@@ -184,9 +251,17 @@ func findAndParseWildcardLocal(pattern string) []*parsedPackage {
 			return nil
 		}
 
-		parsed, err := parseDir(path, fset)
+		// in module mode packages are known by their import path
+		if mod != nil {
+			if importPath, ok := moduleImportPath(mod, dirPath); ok {
+				name = importPath
+			}
+		}
+
+		parsed, err := l.parseDir(dirPath, l.fset)
 		if err != nil {
-			panic(fmt.Sprintf("error parsing %s: %s", path, err))
+			errs = append(errs, newPackageError(name, err))
+			return nil
 		}
 
 		if parsed.code != nil {
@@ -204,10 +279,10 @@ func findAndParseWildcardLocal(pattern string) []*parsedPackage {
 
 		return nil
 	})
-	return pkgs
+	return pkgs, errs
 }
 
-func findAndParseSingle(importPath string) *parsedPackage {
+func (l *Loader) findAndParseSingle(importPath string) (*parsedPackage, *PackageError) {
 	wantXtest := strings.HasSuffix(importPath, ":xtest")
 	importPath = strings.TrimSuffix(importPath, ":xtest")
 
@@ -216,11 +291,31 @@ func findAndParseSingle(importPath string) *parsedPackage {
 	var dir string
 
 	if build.IsLocalImport(path) {
-		dir = path
+		dir = l.localDir(path)
+
+		mod, err := l.modules.moduleFor(dir)
+		if err != nil {
+			return nil, &PackageError{Path: importPath, Err: err}
+		}
+		if mod != nil {
+			if modImportPath, ok := moduleImportPath(mod, dir); ok {
+				importPath = modImportPath
+			}
+		}
 	} else {
-		for _, src := range build.Default.SrcDirs() {
+		modDir, found, err := l.modules.importDir(importPath, "")
+		if err != nil {
+			return nil, &PackageError{Path: importPath, Err: err}
+		}
+		if found && l.overlay.isDir(modDir) {
+			dir = modDir
+		}
+	}
+
+	if dir == "" {
+		for _, src := range l.Context.SrcDirs() {
 			maybeDir := filepath.Join(src, path)
-			if _, err := os.Stat(maybeDir); err != nil {
+			if !l.overlay.isDir(maybeDir) {
 				continue
 			}
 			dir = maybeDir
@@ -229,29 +324,35 @@ func findAndParseSingle(importPath string) *parsedPackage {
 	}
 
 	if dir == "" {
-		panic(fmt.Sprintf("could not find package %s", importPath))
+		return nil, &PackageError{Path: importPath, Err: errNoSuchPackage}
 	}
 
-	parsed, err := parseDir(dir, fset)
+	parsed, err := l.parseDir(dir, l.fset)
 	if err != nil {
-		panic(fmt.Sprintf("error parsing %s: %s", dir, err))
+		return nil, newPackageError(importPath, err)
 	}
 
 	if wantXtest {
-		if parsed.xtest != nil {
-			parsed.xtest.path = importPath + ":xtest"
-			return parsed.xtest
-		} else {
-			panic(fmt.Sprintf("could not find package %s", importPath))
-		}
-	} else {
-		if parsed.code != nil {
-			parsed.code.path = importPath
-			return parsed.code
-		} else {
-			panic(fmt.Sprintf("could not find package %s", importPath))
+		if parsed.xtest == nil {
+			return nil, &PackageError{Path: importPath + ":xtest", Err: errNoSuchPackage}
 		}
+		parsed.xtest.path = importPath + ":xtest"
+		return parsed.xtest, nil
+	}
+
+	if parsed.code == nil {
+		return nil, &PackageError{Path: importPath, Err: errNoSuchPackage}
+	}
+	parsed.code.path = importPath
+	return parsed.code, nil
+}
+
+// localDir returns the directory named by local path p.
+func (l *Loader) localDir(p string) string {
+	if l.Dir == "" || filepath.IsAbs(p) {
+		return p
 	}
+	return filepath.Join(l.Dir, p)
 }
 
 type parsedDir struct {
@@ -260,8 +361,8 @@ type parsedDir struct {
 	nobuild []*parsedPackage
 }
 
-func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
-	entries, err := ioutil.ReadDir(dir)
+func (l *Loader) parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
+	entries, err := l.overlay.readDir(dir)
 	if err != nil {
 		return nil, err
 	}
@@ -289,7 +390,7 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 
 			// slurp contents once so we don't have to open twice when parsing
 			// and checking build match
-			contents, err := ioutil.ReadFile(goFileNames[idx])
+			contents, err := l.overlay.readFile(goFileNames[idx])
 			if err != nil {
 				errors[idx] = err
 				return
@@ -297,7 +398,7 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 
 			goFileContents[idx] = contents
 
-			astFiles[idx], errors[idx] = parser.ParseFile(fset, goFileNames[idx], contents, 0)
+			astFiles[idx], errors[idx] = parser.ParseFile(fset, goFileNames[idx], contents, parser.ParseComments)
 		}(idx)
 	}
 
@@ -309,12 +410,16 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 		}
 	}
 
-	astFiles, err = cgoIfRequired(nil, fset, astFiles)
-	if err != nil {
-		return nil, err
+	// configurations other than l.Context's platform can't run cgo (see
+	// configContext), so there's nothing to do if cgo is disabled
+	if len(l.BuildConfigs) == 0 || l.Context.CgoEnabled {
+		astFiles, err = cgoIfRequired(&l.Context, nil, fset, astFiles)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	ctx := build.Default
+	ctx := l.Context
 
 	pkgs := make(map[string]*parsedPackage)
 
@@ -326,7 +431,8 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 					Name:  f.Name.Name,
 					Files: make(map[string]*ast.File),
 				},
-				fset: fset,
+				fset:        fset,
+				configFiles: make([][]*ast.File, len(l.BuildConfigs)),
 			}
 			pkgs[f.Name.Name] = pkg
 		}
@@ -341,6 +447,37 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 			return ioutil.NopCloser(bytes.NewReader(goFileContents[i])), nil
 		}
 
+		if len(l.BuildConfigs) > 0 {
+			// each configuration is checked separately, so files that aren't
+			// buildable in any of them are left out entirely
+			var match bool
+			for ci, cfg := range l.BuildConfigs {
+				cfgCtx := l.configContext(cfg)
+				cfgCtx.OpenFile = ctx.OpenFile
+
+				var cfgMatch bool
+				if baseName == "C" {
+					cfgMatch = cfgCtx.CgoEnabled
+				} else {
+					cfgMatch, err = cfgCtx.MatchFile(dir, baseName)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				if cfgMatch {
+					pkg.configFiles[ci] = append(pkg.configFiles[ci], f)
+					match = true
+				}
+			}
+
+			if match {
+				pkg.buildFiles = append(pkg.buildFiles, f)
+				pkg.pkg.Files[fileName] = f
+			}
+			continue
+		}
+
 		var match bool
 		if baseName == "C" {
 			match = true
@@ -363,6 +500,10 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 	var ret parsedDir
 	for _, pkg := range pkgs {
 		if len(pkg.buildFiles) == 0 {
+			if len(l.BuildConfigs) > 0 {
+				// not part of any configuration
+				continue
+			}
 			ret.nobuild = append(ret.nobuild, pkg)
 		} else if strings.HasSuffix(pkg.pkg.Name, "_test") {
 			if ret.xtest != nil {
@@ -380,7 +521,7 @@ func parseDir(dir string, fset *token.FileSet) (*parsedDir, error) {
 	return &ret, nil
 }
 
-func cgoIfRequired(bp *build.Package, fset *token.FileSet, astFiles []*ast.File) ([]*ast.File, error) {
+func cgoIfRequired(ctxt *build.Context, bp *build.Package, fset *token.FileSet, astFiles []*ast.File) ([]*ast.File, error) {
 	var hasCgo bool
 Files:
 	for _, f := range astFiles {
@@ -398,7 +539,7 @@ Files:
 
 	if bp == nil {
 		var err error
-		bp, err = build.ImportDir(filepath.Dir(fset.Position(astFiles[0].Pos()).Filename), 0)
+		bp, err = ctxt.ImportDir(filepath.Dir(fset.Position(astFiles[0].Pos()).Filename), 0)
 		if err != nil {
 			return nil, err
 		}
@@ -412,7 +553,9 @@ Files:
 CgoFiles:
 	for _, cf := range cgoFiles {
 		for ai, af := range astFiles {
-			if fset.Position(af.Pos()).Filename == fset.Position(cf.Pos()).Filename {
+			// cgo reports absolute file names, ours may be relative to the
+			// working directory; all files are in the same directory
+			if filepath.Base(fset.Position(af.Pos()).Filename) == filepath.Base(fset.Position(cf.Pos()).Filename) {
 				astFiles[ai] = cf
 				continue CgoFiles
 			}
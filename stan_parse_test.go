@@ -23,7 +23,11 @@ func TestListPackages(t *testing.T) {
 	}
 
 	var gotPaths []string
-	for _, pkg := range findAndParse([]string{"github.com/retailnext/stan/..."})[0] {
+	found, errs := defaultLoader.findAndParse([]string{"github.com/retailnext/stan/..."})
+	if len(errs[0]) > 0 {
+		t.Fatal(errs[0])
+	}
+	for _, pkg := range found[0] {
 		// we return separate packages with pseudo import paths for the
 		// _test packages
 		if strings.HasSuffix(pkg.path, ":xtest") || strings.Contains(pkg.path, ":nobuild") {
@@ -0,0 +1,156 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/types/objectpath"
+)
+
+// Program is a set of packages with an index of the objects they use, for
+// questions about the whole code base rather than a single Package:
+//
+//	prog := stan.NewProgram(stan.Pkgs("your/namespace/...")...)
+//	for _, ref := range prog.ReferencesOf(pkg.LookupObject("your/namespace/api.Deprecated")) {
+//	  t.Errorf("%s uses Deprecated", ref)
+//	}
+type Program struct {
+	// The packages of the program, ordered by path
+	Pkgs []*Package
+
+	refs    map[objectKey][]Reference
+	parents map[ast.Node]ast.Node
+
+	keysMu sync.Mutex
+	enc    objectpath.Encoder
+	keys   map[types.Object]objectKey
+
+	ssaOnce sync.Once
+	ssaProg *ssa.Program
+	ssaPkgs map[*Package]*ssa.Package
+}
+
+// Reference is a use of an object.
+type Reference struct {
+	// Package containing the use
+	Pkg *Package
+	// Identifier denoting the object
+	Ident *ast.Ident
+	// Ancestors of Ident
+	Ancestors Ancestors
+}
+
+// String() returns the position of r.
+func (r Reference) String() string {
+	return r.Pkg.Pos(r.Ident).String()
+}
+
+// objectKey identifies an object across packages, since packages loaded
+// separately may have distinct types.Objects for the same object.
+type objectKey struct {
+	pkg  string
+	path objectpath.Path
+	// objects objectpath can't name (e.g. local variables), which can only
+	// be used by the package declaring them
+	obj types.Object
+}
+
+// NewProgram() indexes the uses of objects in pkgs, such as returned by
+// Pkgs().
+func NewProgram(pkgs ...*Package) *Program {
+	prog := &Program{
+		refs:    make(map[objectKey][]Reference),
+		parents: make(map[ast.Node]ast.Node),
+		keys:    make(map[types.Object]objectKey),
+	}
+
+	seen := make(map[*Package]bool)
+	for _, pkg := range pkgs {
+		if !seen[pkg] {
+			seen[pkg] = true
+			prog.Pkgs = append(prog.Pkgs, pkg)
+		}
+	}
+	sort.SliceStable(prog.Pkgs, func(i, j int) bool {
+		return prog.Pkgs[i].Path() < prog.Pkgs[j].Path()
+	})
+
+	for _, pkg := range prog.Pkgs {
+		files := pkg.BuildFiles()
+		for _, f := range files {
+			WalkAST(f, func(n ast.Node, ancs Ancestors) {
+				if parent := ancs.Peek(); parent != nil {
+					prog.parents[n] = parent
+				}
+			})
+		}
+
+		var uses []*ast.Ident
+		for id := range pkg.TypesInfo.Uses {
+			uses = append(uses, id)
+		}
+		sort.Slice(uses, func(i, j int) bool {
+			return uses[i].Pos() < uses[j].Pos()
+		})
+
+		for _, id := range uses {
+			if _, indexed := prog.parents[id]; !indexed {
+				// not in a buildable file
+				continue
+			}
+			key := prog.keyOf(pkg.TypesInfo.Uses[id])
+			prog.refs[key] = append(prog.refs[key], Reference{Pkg: pkg, Ident: id})
+		}
+	}
+
+	return prog
+}
+
+// keyOf returns the objectKey of obj, or of the generic object obj was
+// instantiated from.
+func (prog *Program) keyOf(obj types.Object) objectKey {
+	obj = originOf(obj)
+
+	prog.keysMu.Lock()
+	defer prog.keysMu.Unlock()
+
+	if key, found := prog.keys[obj]; found {
+		return key
+	}
+
+	key := objectKey{obj: obj}
+	if obj.Pkg() != nil {
+		if path, err := prog.enc.For(obj); err == nil {
+			key = objectKey{pkg: obj.Pkg().Path(), path: path}
+		}
+	}
+
+	prog.keys[obj] = key
+	return key
+}
+
+// ReferencesOf() returns the uses of obj in prog's packages, ordered by
+// package path and position. obj may come from any package, not just
+// prog's. Uses of instantiations of generic types and functions, and of
+// their methods and fields, count as uses of the generic object.
+func (prog *Program) ReferencesOf(obj types.Object) []Reference {
+	refs := prog.refs[prog.keyOf(obj)]
+
+	ret := make([]Reference, len(refs))
+	for i, ref := range refs {
+		for n := prog.parents[ref.Ident]; n != nil; n = prog.parents[n] {
+			ref.Ancestors = append(ref.Ancestors, n)
+		}
+		for a, b := 0, len(ref.Ancestors)-1; a < b; a, b = a+1, b-1 {
+			ref.Ancestors[a], ref.Ancestors[b] = ref.Ancestors[b], ref.Ancestors[a]
+		}
+		ret[i] = ref
+	}
+	return ret
+}
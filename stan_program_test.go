@@ -0,0 +1,83 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/build"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	dir := writeModule(t, "example.com/prog", map[string]string{
+		"api/api.go": `package api
+
+func Deprecated() int { return 0 }
+
+type List[T any] struct{}
+
+func (*List[T]) Push(T) {}
+
+var _ = Deprecated()
+`,
+		"user/user.go": `package user
+
+import "example.com/prog/api"
+
+func use() {
+	x := api.Deprecated()
+	_ = x
+
+	var l api.List[string]
+	l.Push("a")
+}
+`,
+	})
+
+	// separate loaders, so user's api objects are distinct from api's
+	newLoader := func() *Loader {
+		l := NewLoader(build.Default)
+		l.Dir = dir
+		return l
+	}
+	api := newLoader().Pkgs("example.com/prog/api")[0]
+	user := newLoader().Pkgs("example.com/prog/user")[0]
+
+	deprecated := api.LookupObject("example.com/prog/api.Deprecated")
+	if imported := user.TypesPkg.Imports()[0]; imported.Scope().Lookup("Deprecated") == deprecated {
+		t.Fatal("expected distinct objects")
+	}
+
+	prog := NewProgram(user, api, user)
+	if len(prog.Pkgs) != 2 || prog.Pkgs[0] != api {
+		t.Fatalf("got %v", prog.Pkgs)
+	}
+
+	refs := prog.ReferencesOf(deprecated)
+	if len(refs) != 2 || refs[0].Pkg != api || refs[1].Pkg != user || refs[1].Pkg.Pos(refs[1].Ident).Line != 6 {
+		t.Fatalf("got %v", refs)
+	}
+	if sel, _ := refs[1].Ancestors.Peek().(*ast.SelectorExpr); sel == nil || sel.Sel != refs[1].Ident {
+		t.Errorf("got %T", refs[1].Ancestors.Peek())
+	}
+	if _, ok := refs[1].Ancestors[0].(*ast.File); !ok {
+		t.Errorf("got %T", refs[1].Ancestors[0])
+	}
+
+	// uses of the instantiated method count
+	if refs := prog.ReferencesOf(api.LookupObject("example.com/prog/api.List.Push")); len(refs) != 1 || refs[0].Pkg != user {
+		t.Errorf("got %v", refs)
+	}
+
+	// local objects
+	var x *ast.Ident
+	for id, obj := range user.TypesInfo.Defs {
+		if obj != nil && id.Name == "x" {
+			x = id
+		}
+	}
+	if refs := prog.ReferencesOf(user.ObjectOf(x)); len(refs) != 1 || refs[0].Pkg.Pos(refs[0].Ident).Line != 7 {
+		t.Errorf("got %v", refs)
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Report serializes diagnostics for other tools, such as CI code scanning.
+//
+//	r := &stan.Report{Diagnostics: diags, Checks: checks}
+//	err := r.WriteSARIF(os.Stdout)
+type Report struct {
+	// Diagnostics to report
+	Diagnostics []Diagnostic
+	// Checks providing rule metadata for SARIF. Checks named by diagnostics
+	// but not listed here are looked up in the registry.
+	Checks []*Check
+	// Directory file names are made relative to. If empty, RepoRoot() of
+	// the working directory is used. Files outside Root keep their
+	// absolute names.
+	Root string
+}
+
+// ReportFormats are the format names accepted by Report.Write().
+var ReportFormats = []string{"json", "sarif", "junit", "checkstyle"}
+
+// Write() writes r to w in format, one of ReportFormats.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return r.WriteJSON(w)
+	case "sarif":
+		return r.WriteSARIF(w)
+	case "junit":
+		return r.WriteJUnit(w)
+	case "checkstyle":
+		return r.WriteCheckstyle(w)
+	default:
+		return fmt.Errorf("unknown report format %q (expected one of %s)", format, strings.Join(ReportFormats, ", "))
+	}
+}
+
+// RepoRoot() returns the closest directory at or above dir containing a
+// .git entry, or dir if there is none.
+func RepoRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs
+		}
+		d = parent
+	}
+}
+
+func (r *Report) root() string {
+	if r.Root != "" {
+		return r.Root
+	}
+	return RepoRoot(".")
+}
+
+// relPath returns filename relative to root, slash separated.
+func relPath(root, filename string) string {
+	if filename == "" || !filepath.IsAbs(filename) {
+		return filepath.ToSlash(filename)
+	}
+	rel, err := filepath.Rel(root, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(filename)
+	}
+	return filepath.ToSlash(rel)
+}
+
+type jsonPosition struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+}
+
+type jsonRelated struct {
+	jsonPosition
+	Message string `json:"message"`
+}
+
+type jsonDiagnostic struct {
+	jsonPosition
+	Check    string        `json:"check"`
+	Severity string        `json:"severity"`
+	Message  string        `json:"message"`
+	Related  []jsonRelated `json:"related,omitempty"`
+}
+
+// WriteJSON() writes r as JSON lines, one object per diagnostic:
+//
+//	{"file":"a/b.go","line":3,"column":2,"end_line":3,"end_column":8,"check":"timeequal","severity":"error","message":"..."}
+func (r *Report) WriteJSON(w io.Writer) error {
+	root := r.root()
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for _, d := range r.Diagnostics {
+		jd := jsonDiagnostic{
+			jsonPosition: jsonPos(root, d.Pos, d.End),
+			Check:        d.Check,
+			Severity:     d.Severity.String(),
+			Message:      d.Message,
+		}
+		for _, rel := range d.Related {
+			jd.Related = append(jd.Related, jsonRelated{
+				jsonPosition: jsonPos(root, rel.Pos, token.Position{}),
+				Message:      rel.Message,
+			})
+		}
+		if err := enc.Encode(jd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func jsonPos(root string, pos, end token.Position) jsonPosition {
+	ret := jsonPosition{
+		File:   relPath(root, pos.Filename),
+		Line:   pos.Line,
+		Column: pos.Column,
+	}
+	if end.IsValid() {
+		ret.EndLine, ret.EndColumn = end.Line, end.Column
+	}
+	return ret
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string     `json:"id"`
+	ShortDescription *sarifText `json:"shortDescription,omitempty"`
+	FullDescription  *sarifText `json:"fullDescription,omitempty"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            string          `json:"level"`
+	Message          sarifText       `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifText            `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// WriteSARIF() writes r as a SARIF 2.1.0 log with a single run. Each check
+// is a rule described by its Doc. Relative file names are based on
+// %SRCROOT%, which r.Root corresponds to.
+func (r *Report) WriteSARIF(w io.Writer) error {
+	root := r.root()
+
+	checks := make(map[string]*Check)
+	for _, c := range r.Checks {
+		checks[c.Name] = c
+	}
+
+	var (
+		run       = sarifRun{Results: []sarifResult{}}
+		ruleIndex = make(map[string]int)
+	)
+
+	addRule := func(name string) int {
+		if i, ok := ruleIndex[name]; ok {
+			return i
+		}
+		rule := sarifRule{ID: name}
+		c := checks[name]
+		if c == nil {
+			c = LookupCheck(name)
+		}
+		if c != nil && c.Doc != "" {
+			rule.ShortDescription = &sarifText{strings.SplitN(c.Doc, "\n", 2)[0]}
+			rule.FullDescription = &sarifText{c.Doc}
+		}
+		ruleIndex[name] = len(run.Tool.Driver.Rules)
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		return ruleIndex[name]
+	}
+
+	// rules of checks that ran come first, even if they found nothing
+	for _, c := range r.Checks {
+		addRule(c.Name)
+	}
+
+	for _, d := range r.Diagnostics {
+		res := sarifResult{
+			RuleID:    d.Check,
+			RuleIndex: addRule(d.Check),
+			Level:     sarifLevel(d.Severity),
+			Message:   sarifText{d.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical(root, d.Pos, d.End)}},
+		}
+		for i, rel := range d.Related {
+			res.RelatedLocations = append(res.RelatedLocations, sarifLocation{
+				ID:               i + 1,
+				PhysicalLocation: sarifPhysical(root, rel.Pos, token.Position{}),
+				Message:          &sarifText{rel.Message},
+			})
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	run.Tool.Driver.Name = "stan"
+	run.Tool.Driver.InformationURI = "https://github.com/retailnext/stan"
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+func sarifPhysical(root string, pos, end token.Position) sarifPhysicalLocation {
+	loc := sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: relPath(root, pos.Filename)},
+		Region: sarifRegion{
+			StartLine:   pos.Line,
+			StartColumn: pos.Column,
+		},
+	}
+	if !filepath.IsAbs(loc.ArtifactLocation.URI) {
+		loc.ArtifactLocation.URIBaseID = "%SRCROOT%"
+	} else {
+		loc.ArtifactLocation.URI = "file://" + loc.ArtifactLocation.URI
+	}
+	if end.IsValid() {
+		loc.Region.EndLine, loc.Region.EndColumn = end.Line, end.Column
+	}
+	return loc
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit() writes r as JUnit XML with a test suite per check and a
+// failing test case per diagnostic.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	root := r.root()
+
+	byCheck := make(map[string][]Diagnostic)
+	for _, c := range r.Checks {
+		byCheck[c.Name] = nil
+	}
+	for _, d := range r.Diagnostics {
+		byCheck[d.Check] = append(byCheck[d.Check], d)
+	}
+
+	var names []string
+	for name := range byCheck {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suites := junitTestSuites{Suites: []junitTestSuite{}}
+	for _, name := range names {
+		suite := junitTestSuite{Name: name}
+		for _, d := range byCheck[name] {
+			pos := relPos(root, d.Pos)
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      pos,
+				ClassName: name,
+				Failure: &junitFailure{
+					Message: d.Message,
+					Type:    d.Severity.String(),
+					Text:    pos + ": " + d.Message,
+				},
+			})
+		}
+		suite.Tests, suite.Failures = len(suite.Cases), len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return writeXML(w, suites)
+}
+
+type checkstyleResult struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// WriteCheckstyle() writes r as checkstyle XML, grouping diagnostics by
+// file. The source of each error is "stan.<check>".
+func (r *Report) WriteCheckstyle(w io.Writer) error {
+	root := r.root()
+
+	byFile := make(map[string][]checkstyleError)
+	for _, d := range r.Diagnostics {
+		name := relPath(root, d.Pos.Filename)
+		byFile[name] = append(byFile[name], checkstyleError{
+			Line:     d.Pos.Line,
+			Column:   d.Pos.Column,
+			Severity: d.Severity.String(),
+			Message:  d.Message,
+			Source:   "stan." + d.Check,
+		})
+	}
+
+	var names []string
+	for name := range byFile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := checkstyleResult{Version: "4.3"}
+	for _, name := range names {
+		result.Files = append(result.Files, checkstyleFile{Name: name, Errors: byFile[name]})
+	}
+
+	return writeXML(w, result)
+}
+
+func relPos(root string, pos token.Position) string {
+	pos.Filename = relPath(root, pos.Filename)
+	return pos.String()
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
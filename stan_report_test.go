@@ -0,0 +1,146 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+func testReport() *Report {
+	root := filepath.FromSlash("/src/repo")
+	return &Report{
+		Root: root,
+		Checks: []*Check{
+			{Name: "timeequal", Doc: "don't compare time.Time values with ==\n\nUse Equal() instead."},
+			{Name: "clean"},
+		},
+		Diagnostics: []Diagnostic{
+			{
+				Pos:     token.Position{Filename: filepath.Join(root, "a", "a.go"), Line: 3, Column: 2},
+				End:     token.Position{Filename: filepath.Join(root, "a", "a.go"), Line: 3, Column: 8},
+				Check:   "timeequal",
+				Message: "use Equal() & not ==",
+			},
+			{
+				Pos:      token.Position{Filename: filepath.FromSlash("/elsewhere/b.go"), Line: 7, Column: 1},
+				Check:    "other",
+				Severity: SeverityWarning,
+				Message:  "hmm",
+				Related: []RelatedInformation{{
+					Pos:     token.Position{Filename: filepath.Join(root, "a", "a.go"), Line: 1, Column: 1},
+					Message: "declared here",
+				}},
+			},
+		},
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"file":"a/a.go","line":3,"column":2,"end_line":3,"end_column":8,"check":"timeequal","severity":"error","message":"use Equal() & not =="}
+{"file":"/elsewhere/b.go","line":7,"column":1,"check":"other","severity":"warning","message":"hmm","related":[{"file":"a/a.go","line":1,"column":1,"message":"declared here"}]}
+`
+	if filepath.Separator == '/' && buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+}
+
+func TestReportSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteSARIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("got %s", buf.String())
+	}
+	run := log.Runs[0]
+
+	rules := run.Tool.Driver.Rules
+	if len(rules) != 3 || rules[0].ID != "timeequal" || rules[1].ID != "clean" || rules[2].ID != "other" {
+		t.Fatalf("got %+v", rules)
+	}
+	if rules[0].ShortDescription.Text != "don't compare time.Time values with ==" || rules[1].ShortDescription != nil {
+		t.Errorf("got %+v", rules)
+	}
+
+	if len(run.Results) != 2 {
+		t.Fatalf("got %+v", run.Results)
+	}
+	res := run.Results[0]
+	loc := res.Locations[0].PhysicalLocation
+	if res.RuleID != "timeequal" || res.RuleIndex != 0 || res.Level != "error" ||
+		loc.ArtifactLocation.URI != "a/a.go" || loc.ArtifactLocation.URIBaseID != "%SRCROOT%" ||
+		loc.Region != (sarifRegion{3, 2, 3, 8}) {
+		t.Errorf("got %+v", res)
+	}
+	res = run.Results[1]
+	if res.RuleIndex != 2 || res.Level != "warning" || len(res.RelatedLocations) != 1 || res.Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID != "" {
+		t.Errorf("got %+v", res)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, "junit"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="clean" tests="0" failures="0"></testsuite>
+  <testsuite name="other" tests="1" failures="1">
+    <testcase name="` + filepath.FromSlash("/elsewhere/b.go") + `:7:1" classname="other">
+      <failure message="hmm" type="warning">` + filepath.FromSlash("/elsewhere/b.go") + `:7:1: hmm</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="timeequal" tests="1" failures="1">
+    <testcase name="a/a.go:3:2" classname="timeequal">
+      <failure message="use Equal() &amp; not ==" type="error">a/a.go:3:2: use Equal() &amp; not ==</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if filepath.Separator == '/' && buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+}
+
+func TestReportCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().Write(&buf, "checkstyle"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="/elsewhere/b.go">
+    <error line="7" column="1" severity="warning" message="hmm" source="stan.other"></error>
+  </file>
+  <file name="a/a.go">
+    <error line="3" column="2" severity="error" message="use Equal() &amp; not ==" source="stan.timeequal"></error>
+  </file>
+</checkstyle>
+`
+	if filepath.Separator == '/' && buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+
+	if err := testReport().Write(&buf, "yaml"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ssa"
+)
+
+// SSA() returns p in SSA form, for data flow questions that are awkward to
+// answer on the AST, e.g. whether an error value reaches a return
+// statement. It is built from p's type checked syntax the first time it is
+// needed. Imported packages are created without function bodies.
+//
+// Generic functions are also built for each of their instantiations, and
+// debug information is recorded so that SSAValue() can map expressions to
+// values. Use SSANode() or Pos() to map values and instructions back to the
+// source.
+//
+// Packages loaded using Loader.BuildConfigs have no single type checked
+// form; their SSA form is that of the first of Variants(). SSAFunc() and
+// SSAValue() use the first variant building the node's file. Call SSA() on
+// the other variants for the other configurations.
+func (p *Package) SSA() *ssa.Package {
+	if p.variants != nil {
+		return p.variants[0].SSA()
+	}
+
+	p.ssaOnce.Do(func() {
+		_, ssaPkgs := buildSSA(p.Fset, []*Package{p})
+		p.ssaPkg = ssaPkgs[0]
+	})
+	return p.ssaPkg
+}
+
+// SSA() returns the SSA form of prog's packages, built the first time it is
+// needed. Unlike Package.SSA(), calls between prog's packages can be
+// followed into the callee's body. Use SSAPackage() to get the SSA form of
+// one of prog's packages. Packages loaded using Loader.BuildConfigs are
+// built from their first variant, see Package.SSA().
+//
+// The SSA program has one copy of each package. prog's packages may import
+// other copies of each other, e.g. if they were loaded by different Loaders,
+// or if a Loader loaded a package directly after loading a package importing
+// it. Packages importing other copies are type checked again against prog's
+// copies for their SSA form, so its types are not identical to the ones in
+// their TypesInfo.
+func (prog *Program) SSA() *ssa.Program {
+	prog.ssaOnce.Do(func() {
+		fset := token.NewFileSet()
+		if len(prog.Pkgs) > 0 {
+			fset = prog.Pkgs[0].Fset
+		}
+
+		var ssaPkgs []*ssa.Package
+		prog.ssaProg, ssaPkgs = buildSSA(fset, prog.Pkgs)
+
+		prog.ssaPkgs = make(map[*Package]*ssa.Package)
+		for i, pkg := range prog.Pkgs {
+			prog.ssaPkgs[pkg] = ssaPkgs[i]
+		}
+	})
+	return prog.ssaProg
+}
+
+// SSAPackage() returns pkg, one of prog's packages, in SSA form, or nil if
+// pkg is not in prog.
+func (prog *Program) SSAPackage(pkg *Package) *ssa.Package {
+	prog.SSA()
+	return prog.ssaPkgs[pkg]
+}
+
+// buildSSA returns the SSA program of pkgs, with the packages they
+// (transitively) import created from type information alone, and the SSA
+// package of each of pkgs.
+func buildSSA(fset *token.FileSet, pkgs []*Package) (*ssa.Program, []*ssa.Package) {
+	prog := ssa.NewProgram(fset, ssa.InstantiateGenerics)
+
+	// packages loaded using BuildConfigs are built from their first variant
+	pkgs = append([]*Package(nil), pkgs...)
+	for i, pkg := range pkgs {
+		if pkg.variants != nil {
+			pkgs[i] = pkg.variants[0]
+		}
+	}
+
+	created := make(map[string]bool)
+
+	ret := make([]*ssa.Package, len(pkgs))
+	var built []*ssa.Package
+	for i, src := range ssaSources(fset, pkgs) {
+		if ssaPkg := prog.Package(src.tPkg); ssaPkg != nil {
+			// another copy of the same package
+			ret[i] = ssaPkg
+			continue
+		}
+		created[src.tPkg.Path()] = true
+		ret[i] = prog.CreatePackage(src.tPkg, src.files, src.info, true)
+		ret[i].SetDebugMode(true)
+		built = append(built, ret[i])
+	}
+
+	var createImports func(tPkg *types.Package)
+	createImports = func(tPkg *types.Package) {
+		for _, imp := range tPkg.Imports() {
+			if !created[imp.Path()] {
+				created[imp.Path()] = true
+				prog.CreatePackage(imp, nil, nil, true)
+				createImports(imp)
+			}
+		}
+	}
+	for _, ssaPkg := range built {
+		createImports(ssaPkg.Pkg)
+	}
+
+	for _, ssaPkg := range built {
+		ssaPkg.Build()
+	}
+
+	return prog, ret
+}
+
+// ssaSource is the type checked syntax an SSA package is built from.
+type ssaSource struct {
+	tPkg  *types.Package
+	files []*ast.File
+	info  *types.Info
+}
+
+// ssaSources returns the source of each of pkgs, such that they share one
+// copy of each package. The first of pkgs with a given path is that path's
+// copy, and others with the same path share its source. pkgs (transitively)
+// importing other copies of pkgs' packages are type checked again, importing
+// pkgs' copies instead.
+func ssaSources(fset *token.FileSet, pkgs []*Package) []*ssaSource {
+	var (
+		ret    = make([]*ssaSource, len(pkgs))
+		byPath = make(map[string]*ssaSource)
+		pkgOf  = make(map[string]*Package)
+		// pkgs' copies, as loaded
+		loaded = make(map[string]*types.Package)
+	)
+	for i, pkg := range pkgs {
+		path := pkg.TypesPkg.Path()
+		if byPath[path] == nil {
+			byPath[path] = &ssaSource{pkg.TypesPkg, pkg.BuildFiles(), pkg.TypesInfo}
+			pkgOf[path] = pkg
+			loaded[path] = pkg.TypesPkg
+		}
+		ret[i] = byPath[path]
+	}
+
+	// stale reports whether tPkg (transitively) imports another copy of one
+	// of pkgs' packages
+	staleMemo := make(map[*types.Package]bool)
+	var stale func(*types.Package) bool
+	stale = func(tPkg *types.Package) bool {
+		if s, found := staleMemo[tPkg]; found {
+			return s
+		}
+		var s bool
+		for _, imp := range tPkg.Imports() {
+			if other := loaded[imp.Path()]; other != nil && other != imp || stale(imp) {
+				s = true
+				break
+			}
+		}
+		staleMemo[tPkg] = s
+		return s
+	}
+
+	var anyStale bool
+	for _, tPkg := range loaded {
+		anyStale = anyStale || stale(tPkg)
+	}
+	if !anyStale {
+		return ret
+	}
+
+	// everything that isn't stale is imported as is; stale packages not in
+	// pkgs are imported from source
+	seed := make(map[string]*types.Package)
+	var addSeed func(*types.Package)
+	addSeed = func(tPkg *types.Package) {
+		if seed[tPkg.Path()] != nil || stale(tPkg) {
+			return
+		}
+		seed[tPkg.Path()] = tPkg
+		for _, imp := range tPkg.Imports() {
+			addSeed(imp)
+		}
+	}
+	for _, tPkg := range loaded {
+		addSeed(tPkg)
+	}
+	imp := pkgs[0].loader.newImporter(fset, seed, "")
+
+	// pkgs' packages a package transitively imports
+	importsMemo := make(map[*types.Package][]string)
+	var pkgsImported func(*types.Package) []string
+	pkgsImported = func(tPkg *types.Package) []string {
+		if paths, found := importsMemo[tPkg]; found {
+			return paths
+		}
+		var paths []string
+		for _, imp := range tPkg.Imports() {
+			if loaded[imp.Path()] != nil {
+				paths = append(paths, imp.Path())
+			}
+			paths = append(paths, pkgsImported(imp)...)
+		}
+		importsMemo[tPkg] = paths
+		return paths
+	}
+
+	checked := make(map[string]bool)
+	var check func(path string)
+	check = func(path string) {
+		if checked[path] || !stale(loaded[path]) {
+			return
+		}
+		checked[path] = true
+
+		// the importer must import the new copies of stale packages, even
+		// if imported through packages not in pkgs
+		for _, dep := range pkgsImported(loaded[path]) {
+			check(dep)
+		}
+
+		pkg, src := pkgOf[path], byPath[path]
+		config := &types.Config{
+			Importer: imp,
+			// pkg type checked before, and the new copies are alike
+			Error: func(error) {},
+			Sizes: types.SizesFor("gc", pkg.loader.Context.GOARCH),
+		}
+		info := newTypesInfo()
+		tPkg, _ := config.Check(path, pkg.Fset, src.files, info)
+
+		imp.add(path, tPkg)
+		src.tPkg, src.info = tPkg, info
+	}
+	for _, pkg := range pkgs {
+		check(pkg.TypesPkg.Path())
+	}
+
+	return ret
+}
+
+// SSAFunc() returns the SSA function containing n, which can be a
+// *ast.FuncDecl, *ast.FuncLit or any node within one. Package level
+// variable initializers are in the package's init function. SSAFunc()
+// returns nil if n is not in a function, e.g. in a type declaration.
+func (p *Package) SSAFunc(n ast.Node) *ssa.Function {
+	if p.variants != nil {
+		tf := p.Fset.File(n.Pos())
+		for _, v := range p.variants {
+			for _, f := range v.buildFiles {
+				if p.Fset.File(f.Pos()) == tf {
+					return v.SSAFunc(n)
+				}
+			}
+		}
+		return nil
+	}
+
+	path := []ast.Node{n}
+	ancs := p.AncestorsOf(n)
+	for i := len(ancs) - 1; i >= 0; i-- {
+		path = append(path, ancs[i])
+	}
+	if _, isPkg := path[len(path)-1].(*ast.Package); isPkg {
+		path = path[:len(path)-1]
+	}
+
+	return ssa.EnclosingFunction(p.SSA(), path)
+}
+
+// SSAValue() returns the SSA value of expression e, or nil if there is
+// none, e.g. for constants, types and expressions the builder optimized
+// away. For addressable expressions used as lvalues, the value is e's
+// address.
+func (p *Package) SSAValue(e ast.Expr) ssa.Value {
+	fn := p.SSAFunc(e)
+	if fn == nil {
+		return nil
+	}
+	v, _ := fn.ValueForExpr(e)
+	return v
+}
+
+// SSANode() returns the AST node that SSA value or instruction x was built
+// from: an expression of values with debug information (see SSAValue()),
+// otherwise the innermost node at x.Pos(), such as the *ast.CallExpr of a
+// *ssa.Call or the *ast.ReturnStmt of a *ssa.Return. SSANode() returns nil
+// if x has no position in p.
+func (p *Package) SSANode(x Poser) ast.Node {
+	if v, _ := x.(ssa.Value); v != nil && v.Parent() != nil {
+		for _, b := range v.Parent().Blocks {
+			for _, instr := range b.Instrs {
+				if ref, _ := instr.(*ssa.DebugRef); ref != nil && ref.X == v {
+					return ref.Expr
+				}
+			}
+		}
+	}
+
+	pos := x.Pos()
+	if !pos.IsValid() {
+		return nil
+	}
+
+	f := p.Files()[p.Fset.Position(pos).Filename]
+	if f == nil || pos < f.Pos() || pos > f.End() {
+		return nil
+	}
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	if len(path) == 0 {
+		return nil
+	}
+	return path[0]
+}
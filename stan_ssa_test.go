@@ -0,0 +1,248 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/build"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+func TestSSA(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+import "os"
+
+func open(name string) (*os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func dropped(name string) {
+	_, err := os.Open(name)
+	func() {
+		_ = err
+	}()
+}
+
+var opened, _ = open("x")
+`)
+
+	if pkg.SSA() != pkg.SSA() {
+		t.Error("expected SSA to be cached")
+	}
+
+	openObj := pkg.LookupObject(pkg.Path() + ".open")
+	_, decl, ancs := pkg.DeclOf(openObj)
+	openDecl := ancs.Peek().(*ast.FuncDecl)
+	if decl != openDecl.Name {
+		t.Fatalf("got %v", decl)
+	}
+
+	fn := pkg.SSAFunc(openDecl)
+	if fn == nil || fn.Name() != "open" || fn != pkg.SSA().Func("open") {
+		t.Fatalf("got %v", fn)
+	}
+
+	// does the error of os.Open() reach a return?
+	returnsErr := func(fn *ssa.Function) bool {
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				call, _ := instr.(*ssa.Call)
+				if call == nil || call.Call.StaticCallee() == nil || call.Call.StaticCallee().Name() != "Open" {
+					continue
+				}
+				for _, ref := range *call.Referrers() {
+					extract, _ := ref.(*ssa.Extract)
+					if extract == nil || extract.Index != 1 {
+						continue
+					}
+					for _, use := range *extract.Referrers() {
+						if _, ok := use.(*ssa.Return); ok {
+							return true
+						}
+					}
+				}
+			}
+		}
+		return false
+	}
+	if !returnsErr(fn) {
+		t.Error("expected open to return the error")
+	}
+	if returnsErr(pkg.SSA().Func("dropped")) {
+		t.Error("expected dropped not to return the error")
+	}
+
+	// expressions to values and back
+	ret := openDecl.Body.List[1].(*ast.IfStmt).Body.List[0].(*ast.ReturnStmt)
+	errExpr := ret.Results[1]
+	v := pkg.SSAValue(errExpr)
+	if _, ok := v.(*ssa.Extract); !ok {
+		t.Fatalf("got %T", v)
+	}
+	if id, _ := pkg.SSANode(v).(*ast.Ident); id == nil || id.Name != "err" {
+		t.Errorf("got %v", pkg.SSANode(v))
+	}
+	// extracts have no position of their own
+	if v.Pos().IsValid() || pkg.Pos(pkg.SSANode(v)).Line != 7 {
+		t.Errorf("got %s", pkg.Pos(pkg.SSANode(v)))
+	}
+
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			switch instr.(type) {
+			case *ssa.Call:
+				if _, ok := pkg.SSANode(instr).(*ast.CallExpr); !ok {
+					t.Errorf("got %T for %s", pkg.SSANode(instr), instr)
+				}
+			case *ssa.Return:
+				if _, ok := pkg.SSANode(instr).(*ast.ReturnStmt); !ok {
+					t.Errorf("got %T for %s", pkg.SSANode(instr), instr)
+				}
+			}
+		}
+	}
+
+	// function literals and package level initializers
+	droppedDecl := pkg.SSAFunc(pkg.SSA().Func("dropped").Syntax()).Syntax().(*ast.FuncDecl)
+	lit := droppedDecl.Body.List[1].(*ast.ExprStmt).X.(*ast.CallExpr).Fun.(*ast.FuncLit)
+	if fn := pkg.SSAFunc(lit.Body); fn == nil || fn.Name() != "dropped$1" {
+		t.Errorf("got %v", fn)
+	}
+	for _, f := range pkg.Files() {
+		spec := f.Decls[len(f.Decls)-1].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		if fn := pkg.SSAFunc(spec.Values[0]); fn == nil || fn.Name() != "init" {
+			t.Errorf("got %v", fn)
+		}
+	}
+}
+
+func TestProgramSSA(t *testing.T) {
+	dir := writeModule(t, "example.com/ssa", map[string]string{
+		"a/a.go": `package a
+
+func Double(x int) int { return 2 * x }
+`,
+		"b/b.go": `package b
+
+import "example.com/ssa/a"
+
+func Quadruple(x int) int { return a.Double(a.Double(x)) }
+`,
+		"c/c.go": `package c
+
+import "example.com/ssa/b"
+
+func Sixteenfold(x int) int { return b.Quadruple(b.Quadruple(x)) }
+`,
+	})
+
+	l := NewLoader(build.Default)
+	l.Dir = dir
+	pkgs := l.Pkgs("example.com/ssa/...")
+	if len(pkgs) != 3 {
+		t.Fatalf("got %v", pkgs)
+	}
+
+	prog := NewProgram(pkgs...)
+	if prog.SSA() != prog.SSA() {
+		t.Error("expected SSA to be cached")
+	}
+
+	firstCallee := func(fn *ssa.Function) *ssa.Function {
+		for _, instr := range fn.Blocks[0].Instrs {
+			if call, _ := instr.(*ssa.Call); call != nil {
+				return call.Call.StaticCallee()
+			}
+		}
+		return nil
+	}
+
+	// a's functions have bodies in the program, but not in b's own SSA
+	if double := firstCallee(prog.SSAPackage(pkgs[1]).Func("Quadruple")); double == nil || len(double.Blocks) == 0 {
+		t.Errorf("got %v", double)
+	}
+	if double := firstCallee(pkgs[1].SSA().Func("Quadruple")); double == nil || len(double.Blocks) != 0 {
+		t.Errorf("got %v", double)
+	}
+
+	// packages of separate loaders share one copy of each package
+	other := NewLoader(build.Default)
+	other.Dir = dir
+	mixed := NewProgram(pkgs[0], other.Pkgs("example.com/ssa/b")[0])
+	if double := firstCallee(mixed.SSAPackage(mixed.Pkgs[1]).Func("Quadruple")); double == nil || len(double.Blocks) == 0 || double.Pkg != mixed.SSAPackage(mixed.Pkgs[0]) {
+		t.Errorf("got %v", double)
+	}
+
+	// also when the other copies are imported through a package not in the
+	// program
+	mixed = NewProgram(pkgs[0], other.Pkgs("example.com/ssa/c")[0])
+	if quadruple := firstCallee(mixed.SSAPackage(mixed.Pkgs[1]).Func("Sixteenfold")); quadruple == nil || quadruple.Pkg.Pkg.Path() != "example.com/ssa/b" {
+		t.Errorf("got %v", quadruple)
+	}
+
+	// as do packages loaded after a package importing them, in any order
+	for _, order := range [][]string{
+		{"example.com/sep/b", "example.com/sep/a"},
+		{"example.com/sep/a", "example.com/sep/b"},
+	} {
+		a, b := loadSeparately(t, order...)
+		for _, prog := range []*Program{NewProgram(a, b), NewProgram(b, a)} {
+			ssaA, ssaB := prog.SSAPackage(a), prog.SSAPackage(b)
+			if ssaA == nil || ssaB == nil {
+				t.Fatalf("%v: got %v, %v", order, ssaA, ssaB)
+			}
+			// Use refers to a's V
+			var global *ssa.Global
+			for _, b := range ssaB.Func("Use").Blocks {
+				for _, instr := range b.Instrs {
+					for _, op := range instr.Operands(nil) {
+						if g, _ := (*op).(*ssa.Global); g != nil {
+							global = g
+						}
+					}
+				}
+			}
+			if global == nil || global != ssaA.Var("V") {
+				t.Errorf("%v: got %v", order, global)
+			}
+			if m := prog.SSA().LookupMethod(ssaA.Type("T").Type(), ssaA.Pkg, "M"); m == nil || len(m.Blocks) == 0 {
+				t.Errorf("%v: got %v", order, m)
+			}
+		}
+	}
+}
+
+func TestBuildConfigsSSA(t *testing.T) {
+	l := NewLoader(build.Default)
+	l.BuildConfigs = []BuildConfig{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+	}
+	bar := l.Pkgs("github.com/retailnext/stan/internal/bar")[0]
+
+	// built from the first variant
+	if ssaPkg := bar.SSA(); ssaPkg == nil || ssaPkg != bar.Variants()[0].SSA() || ssaPkg.Func("linuxSpecific") == nil {
+		t.Fatalf("got %v", ssaPkg)
+	}
+	if ssaPkg := NewProgram(bar).SSAPackage(bar); ssaPkg == nil || ssaPkg.Func("linuxSpecific") == nil {
+		t.Errorf("got %v", ssaPkg)
+	}
+
+	// functions of the other variants are found by their files
+	for _, name := range []string{"linuxSpecific", "windowsSpecific"} {
+		obj := bar.LookupObject("github.com/retailnext/stan/internal/bar." + name)
+		decl := bar.AncestorsOf(bar.LifetimeOf(obj).Def).Peek()
+		if fn := bar.SSAFunc(decl); fn == nil || fn.Name() != name {
+			t.Errorf("%s: got %v", name, fn)
+		}
+	}
+}
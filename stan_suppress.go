@@ -0,0 +1,187 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Suppression is a "//stan:ignore check reason" comment. It suppresses
+// diagnostics of the named check (or comma separated checks) within its
+// extent, which depends on where the comment is:
+//   - at the end of a line: that line's statement or declaration
+//   - on its own line: the following statement or declaration
+//   - in a declaration's doc comment: the declaration
+//   - before the package clause: the whole file
+//
+// See ast.NewCommentMap() for exactly how comments are associated with
+// nodes.
+type Suppression struct {
+	Directive
+	// Check names the suppression applies to
+	Checks []string
+	// Why the diagnostics are suppressed
+	Reason string
+	// File and line range the suppression applies to, inclusive
+	Filename         string
+	FromLine, ToLine int
+}
+
+// Covers() reports whether s suppresses d.
+func (s *Suppression) Covers(d Diagnostic) bool {
+	if d.Pos.Filename != s.Filename || d.Pos.Line < s.FromLine || d.Pos.Line > s.ToLine {
+		return false
+	}
+	return s.appliesTo(d.Check)
+}
+
+func (s *Suppression) appliesTo(check string) bool {
+	for _, c := range s.Checks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppressions() returns the "//stan:ignore" suppressions in p, ordered by
+// position.
+func (p *Package) Suppressions() []*Suppression {
+	var ret []*Suppression
+
+	for _, f := range p.Node.Files {
+		tf := p.Fset.File(f.Pos())
+
+		for node, groups := range p.commentMap(f) {
+			for _, group := range groups {
+				for _, c := range group.List {
+					d, ok := parseDirective(c)
+					if !ok || d.Prefix != "stan" || d.Name != "ignore" {
+						continue
+					}
+
+					s := &Suppression{
+						Directive: d,
+						Filename:  tf.Name(),
+					}
+
+					fields := strings.Fields(d.Args)
+					if len(fields) > 0 {
+						s.Checks = strings.Split(fields[0], ",")
+						s.Reason = strings.Join(fields[1:], " ")
+					}
+
+					if _, isFile := node.(*ast.File); isFile && c.Pos() < f.Package {
+						s.FromLine, s.ToLine = 1, tf.LineCount()
+					} else if isFile {
+						// the comment map attaches comments after the last
+						// declaration to the file
+						s.FromLine, s.ToLine = trailingExtent(tf, f, c)
+					} else {
+						s.FromLine = tf.Line(node.Pos())
+						s.ToLine = tf.Line(node.End())
+						if line := tf.Line(c.Pos()); line < s.FromLine {
+							s.FromLine = line
+						} else if line > s.ToLine {
+							s.ToLine = line
+						}
+					}
+
+					ret = append(ret, s)
+				}
+			}
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Filename != ret[j].Filename {
+			return ret[i].Filename < ret[j].Filename
+		}
+		return ret[i].Pos() < ret[j].Pos()
+	})
+
+	return ret
+}
+
+// trailingExtent returns the lines covered by c, a comment after the package
+// clause that isn't attached to a statement or declaration: the declaration
+// ending on c's line or starting on the next line, or else just c's line.
+func trailingExtent(tf *token.File, f *ast.File, c *ast.Comment) (from, to int) {
+	line := tf.Line(c.Pos())
+	for _, decl := range f.Decls {
+		if tf.Line(decl.End()) == line || tf.Line(decl.Pos()) == line+1 {
+			from, to = tf.Line(decl.Pos()), tf.Line(decl.End())
+			if line < from {
+				from = line
+			}
+			return from, to
+		}
+	}
+	return line, line
+}
+
+// Suppress() filters diags against p's suppressions, returning the
+// diagnostics not suppressed and a diagnostic (of check "stan:ignore") for
+// each suppression that didn't suppress anything. Only suppressions for
+// checks, the names of the checks that produced diags, are reported unused;
+// if checks is empty all are. Suppressions without a check name are always
+// reported.
+func (p *Package) Suppress(diags []Diagnostic, checks ...string) (kept, unused []Diagnostic) {
+	return p.suppress(diags, true, checks...)
+}
+
+// suppress is Suppress(), optionally leaving out suppressions without a check
+// name, for callers filtering the diagnostics of the same package several
+// times.
+func (p *Package) suppress(diags []Diagnostic, nameless bool, checks ...string) (kept, unused []Diagnostic) {
+	suppressions := p.Suppressions()
+	used := make([]bool, len(suppressions))
+
+Diags:
+	for _, d := range diags {
+		for i, s := range suppressions {
+			if s.Covers(d) {
+				used[i] = true
+				continue Diags
+			}
+		}
+		kept = append(kept, d)
+	}
+
+	for i, s := range suppressions {
+		if used[i] {
+			continue
+		}
+
+		if len(s.Checks) == 0 {
+			if !nameless {
+				continue
+			}
+			unused = append(unused, Diagnostic{
+				Pos:     p.Pos(s),
+				Check:   "stan:ignore",
+				Message: "suppression does not name a check",
+			})
+			continue
+		}
+
+		ran := len(checks) == 0
+		for _, c := range checks {
+			ran = ran || s.appliesTo(c)
+		}
+		if ran {
+			unused = append(unused, Diagnostic{
+				Pos:     p.Pos(s),
+				Check:   "stan:ignore",
+				Message: fmt.Sprintf("unused suppression for %s", strings.Join(s.Checks, ",")),
+			})
+		}
+	}
+
+	return kept, unused
+}
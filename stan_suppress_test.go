@@ -0,0 +1,92 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSuppress(t *testing.T) {
+	pkg := EvalPkg(`
+package fake
+
+var badOne = 1 //stan:ignore nobad legacy
+
+//stan:ignore nobad,other whole decl
+func f() {
+	badTwo := 2
+	_ = badTwo
+}
+
+func g() {
+	//stan:ignore nobad next statement
+	badThree := 3
+
+	badFour := badThree
+	_ = badFour //stan:ignore nobad just this line
+
+	//stan:ignore other unrelated
+	badFive := 5
+	_ = badFive
+}
+
+//stan:ignore nobad unused
+var good = 1
+
+//stan:ignore
+var alsoGood = 2
+`)
+
+	diags := noBadCheck.Diagnose(pkg)
+
+	kept, unused := pkg.Suppress(diags, "nobad")
+
+	var got []string
+	for _, d := range kept {
+		got = append(got, strings.TrimPrefix(d.Message, "don't name things "))
+	}
+	expected := []string{"badFour", "badThree", "badFive", "badFive"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v", got)
+	}
+
+	got = nil
+	for _, d := range unused {
+		got = append(got, d.Message)
+	}
+	expected = []string{
+		"unused suppression for nobad",
+		"suppression does not name a check",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v", got)
+	}
+
+	// without check names, every unused suppression is reported
+	if _, unused := pkg.Suppress(diags); len(unused) != 3 {
+		t.Errorf("got %v", unused)
+	}
+
+	suppressions := pkg.Suppressions()
+	if len(suppressions) != 7 {
+		t.Fatalf("got %d suppressions", len(suppressions))
+	}
+	if s := suppressions[1]; !reflect.DeepEqual(s.Checks, []string{"nobad", "other"}) || s.Reason != "whole decl" || s.ToLine-s.FromLine != 4 {
+		t.Errorf("got %+v", s)
+	}
+
+	// a trailing comment on the last declaration only covers that
+	pkg = EvalPkg(`
+package fake
+
+var badOne = 1
+
+var badTwo = 2 //stan:ignore nobad last
+`)
+	if s := pkg.Suppressions(); len(s) != 1 || s[0].FromLine != 6 || s[0].ToLine != 6 {
+		t.Errorf("got %+v", s)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ExpectDiagnostics() unit tests a check. It evaluates code with EvalPkg(),
+// runs check on the result and compares the diagnostics against "want"
+// comments in code:
+//
+//	if now == then { // want `use Equal\(\)` "another on the same line"
+//
+// Each string literal in a want comment is a regexp that must match the
+// message of a distinct diagnostic on the comment's line. Missing,
+// unexpected and mismatched diagnostics are reported with t.Errorf().
+func ExpectDiagnostics(t testing.TB, check func(*Package) []Diagnostic, code string) {
+	t.Helper()
+
+	pkg, err := TryEvalPkg(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectDiagnostics(t, pkg, check(pkg))
+}
+
+type wantKey struct {
+	file string
+	line int
+}
+
+type want struct {
+	re      *regexp.Regexp
+	matched bool
+}
+
+func expectDiagnostics(t testing.TB, pkg *Package, diags []Diagnostic) {
+	t.Helper()
+
+	wants := make(map[wantKey][]*want)
+
+	for name, f := range pkg.Files() {
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				res, err := parseWant(c.Text)
+				if err != nil {
+					t.Errorf("%s: %s", pkg.Pos(c), err)
+					continue
+				}
+
+				key := wantKey{name, pkg.Pos(c).Line}
+				for _, re := range res {
+					wants[key] = append(wants[key], &want{re: re})
+				}
+			}
+		}
+	}
+
+Diags:
+	for _, d := range diags {
+		key := wantKey{d.Pos.Filename, d.Pos.Line}
+
+		lineWants := wants[key]
+		if len(lineWants) == 0 {
+			t.Errorf("line %d: unexpected diagnostic: %s", d.Pos.Line, d.Message)
+			continue
+		}
+
+		var patterns []string
+		for _, w := range lineWants {
+			if !w.matched && w.re.MatchString(d.Message) {
+				w.matched = true
+				continue Diags
+			}
+			patterns = append(patterns, strconv.Quote(w.re.String()))
+		}
+
+		t.Errorf("line %d: diagnostic %q doesn't match want %s", d.Pos.Line, d.Message, strings.Join(patterns, " "))
+	}
+
+	var keys []wantKey
+	for key := range wants {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].file != keys[j].file {
+			return keys[i].file < keys[j].file
+		}
+		return keys[i].line < keys[j].line
+	})
+
+	for _, key := range keys {
+		for _, w := range wants[key] {
+			if !w.matched {
+				t.Errorf("line %d: no diagnostic matching %q", key.line, w.re)
+			}
+		}
+	}
+}
+
+// parseWant returns the regexps of a "want" comment, or nil if comment isn't
+// one.
+func parseWant(comment string) ([]*regexp.Regexp, error) {
+	text := strings.TrimPrefix(comment, "//")
+	if strings.HasPrefix(comment, "/*") {
+		text = strings.TrimSuffix(comment[2:], "*/")
+	}
+
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "want ") {
+		return nil, nil
+	}
+	text = text[len("want "):]
+
+	var (
+		s       scanner.Scanner
+		scanErr error
+		ret     []*regexp.Regexp
+	)
+
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(text)), []byte(text), func(pos token.Position, msg string) {
+		scanErr = fmt.Errorf("invalid want comment: %s", msg)
+	}, 0)
+
+	for {
+		_, tok, lit := s.Scan()
+		if scanErr != nil {
+			return nil, scanErr
+		}
+
+		switch tok {
+		case token.EOF:
+			if len(ret) == 0 {
+				return nil, fmt.Errorf("want comment has no patterns")
+			}
+			return ret, nil
+		case token.SEMICOLON:
+			// automatically inserted at end of input
+			continue
+		case token.STRING:
+			pattern, err := strconv.Unquote(lit)
+			if err != nil {
+				return nil, fmt.Errorf("invalid want pattern %s: %s", lit, err)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid want pattern %s: %s", lit, err)
+			}
+			ret = append(ret, re)
+		default:
+			return nil, fmt.Errorf("invalid want comment: expected string literal, got %s", tok)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectDiagnostics(t *testing.T) {
+	ExpectDiagnostics(t, noBadCheck.Diagnose, `
+package fake
+
+var badOne = 1 // want "badOne"
+
+var good = 2
+
+var badTwo, badThree = 3, 4 // want "badTwo" `+"`bad(Three|Four)`"+`
+
+/* want "badFour" */ var badFour = 5
+`)
+
+	rec := &recordingT{TB: t}
+	ExpectDiagnostics(rec, noBadCheck.Diagnose, `
+package fake
+
+var badOne = 1 // want "badOne" "badOne"
+
+var good = 2 // want "good"
+
+var badTwo = 3 // want "badThree"
+
+var badFour = 4
+
+var badFive = 5 // want bad
+`)
+
+	expected := []string{
+		"line 8: diagnostic \"don't name things badTwo\" doesn't match want \"badThree\"",
+		"line 10: unexpected diagnostic: don't name things badFour",
+		"line 12: unexpected diagnostic: don't name things badFive",
+		"line 4: no diagnostic matching \"badOne\"",
+		"line 6: no diagnostic matching \"good\"",
+		"line 8: no diagnostic matching \"badThree\"",
+	}
+
+	if len(rec.errors) == 0 || !strings.Contains(rec.errors[0], "expected string literal") {
+		t.Errorf("got %v", rec.errors)
+	} else if got := rec.errors[1:]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -6,13 +6,33 @@ package stan
 import (
 	"fmt"
 	"go/ast"
-	"go/build"
+	"go/token"
 	"go/types"
+	"sort"
 )
 
-func typeCheck(pkg *parsedPackage, importer types.ImporterFrom) *Package {
-	if importer == nil {
-		importer = imp
+// typeCheck type checks pkg. wrapImporter, if non-nil, can wrap the importer
+// used for pkg's imports.
+func (l *Loader) typeCheck(pkg *parsedPackage, wrapImporter func(types.ImporterFrom) types.ImporterFrom) (*Package, *PackageError) {
+	if len(l.BuildConfigs) > 0 {
+		return l.typeCheckConfigs(pkg, wrapImporter)
+	}
+
+	dedupeObjects(pkg.buildFiles, pkg.nonBuildFiles)
+
+	// check buildable files first so in the case of duplicate
+	// objects, the buildable file keeps the original name
+	allFiles := append(pkg.buildFiles, pkg.nonBuildFiles...)
+
+	return l.checkFiles(pkg, allFiles, wrapImporter)
+}
+
+// checkFiles type checks files of pkg, ignoring hard errors in pkg's
+// non-buildable files.
+func (l *Loader) checkFiles(pkg *parsedPackage, files []*ast.File, wrapImporter func(types.ImporterFrom) types.ImporterFrom) (*Package, *PackageError) {
+	var importer types.ImporterFrom = l.imp
+	if wrapImporter != nil {
+		importer = wrapImporter(importer)
 	}
 
 	var hardError error
@@ -35,30 +55,50 @@ func typeCheck(pkg *parsedPackage, importer types.ImporterFrom) *Package {
 				}
 			}
 
-			hardError = err
+			if hardError == nil {
+				hardError = err
+			}
 		},
-		Sizes: types.SizesFor("gc", build.Default.GOARCH),
+		Sizes: types.SizesFor("gc", l.Context.GOARCH),
 	}
-	info := types.Info{
-		Types:     make(map[ast.Expr]types.TypeAndValue),
-		Defs:      make(map[*ast.Ident]types.Object),
-		Uses:      make(map[*ast.Ident]types.Object),
-		Implicits: make(map[ast.Node]types.Object),
-		Scopes:    make(map[ast.Node]*types.Scope),
+	info := newTypesInfo()
+
+	tPkg, _ := config.Check(pkg.path, pkg.fset, files, info)
+
+	if hardError != nil {
+		return nil, newPackageError(pkg.path, hardError)
 	}
 
-	dedupeObjects(pkg.buildFiles, pkg.nonBuildFiles)
+	ret := l.newPackage(pkg.pkg, pkg.fset, info, tPkg)
 
-	// check buildable files first so in the case of duplicate
-	// objects, the buildable file keeps the original name
-	allFiles := append(pkg.buildFiles, pkg.nonBuildFiles...)
+	nonBuild := make(map[*ast.File]bool)
+	for _, f := range pkg.nonBuildFiles {
+		nonBuild[f] = true
+	}
+	for _, f := range files {
+		if !nonBuild[f] {
+			ret.buildFiles = append(ret.buildFiles, f)
+		}
+	}
 
-	tPkg, _ := config.Check(pkg.path, pkg.fset, allFiles, &info)
+	return ret, nil
+}
 
-	if hardError != nil {
-		panic(fmt.Sprintf("type checker error: %s", hardError))
+func newTypesInfo() *types.Info {
+	return &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		FileVersions: make(map[*ast.File]string),
 	}
+}
 
+// newPackage makes a *Package out of type checked syntax.
+func (l *Loader) newPackage(node *ast.Package, fset *token.FileSet, info *types.Info, tPkg *types.Package) *Package {
 	lifetimes := make(map[types.Object]ObjectLifetime)
 
 	updateLifetimes := func(objs map[*ast.Ident]types.Object, isUse bool) {
@@ -66,6 +106,9 @@ func typeCheck(pkg *parsedPackage, importer types.ImporterFrom) *Package {
 			if obj == nil {
 				continue
 			}
+			// uses of instantiated methods and fields count as uses of
+			// the generic ones
+			obj = originOf(obj)
 			sp, ok := lifetimes[obj]
 			if !ok || ident.Pos() < sp.First {
 				sp.First = ident.Pos()
@@ -85,11 +128,19 @@ func typeCheck(pkg *parsedPackage, importer types.ImporterFrom) *Package {
 	updateLifetimes(info.Defs, false)
 	updateLifetimes(info.Uses, true)
 
+	// order uses by position so results derived from them are deterministic
+	for _, sp := range lifetimes {
+		sort.Slice(sp.Uses, func(i, j int) bool {
+			return sp.Uses[i].Pos() < sp.Uses[j].Pos()
+		})
+	}
+
 	return &Package{
-		Node:         pkg.pkg,
-		Fset:         pkg.fset,
-		TypesInfo:    &info,
+		Node:         node,
+		Fset:         fset,
+		TypesInfo:    info,
 		TypesPkg:     tPkg,
+		loader:       l,
 		lifetimes:    lifetimes,
 		typesCache:   make(map[string]types.Type),
 		objectsCache: make(map[string]types.Object),
@@ -102,7 +153,10 @@ type nameWithRecv struct {
 }
 
 // find any duplicate objects and rename them in the non buildable files
-// so they are at least present after type checking
+// so they are at least present after type checking. Names from earlier non
+// buildable files count as used too, so a name declared in several non
+// buildable files (but no buildable one) is renamed name_nobuild1,
+// name_nobuild2, ... after its first declaration.
 func dedupeObjects(buildable, nonBuildable []*ast.File) {
 
 	// we need to check all file level declarations (variables, constants, functions
@@ -165,10 +219,13 @@ func dedupeObjects(buildable, nonBuildable []*ast.File) {
 					newName = fmt.Sprintf("%s_nobuild%d", name.name, usedNames[name])
 				}
 
-				usedNames[name]++
+				usedNames[nameWithRecv{name: newName, recv: name.recv}]++
 
 				nameId.Name = newName
 			}
+
+			// later non-buildable files can collide with this one too
+			usedNames[name]++
 		})
 	}
 }
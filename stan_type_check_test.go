@@ -0,0 +1,54 @@
+// Copyright (c) 2018, RetailNext, Inc.
+// All rights reserved.
+
+package stan
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeObjects(t *testing.T) {
+	fset := token.NewFileSet()
+	parse := func(src string) *ast.File {
+		f, err := parser.ParseFile(fset, "", "package p\n"+src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	buildable := []*ast.File{
+		parse("func f() {}\nvar f_nobuild2 int"),
+	}
+	nonBuildable := []*ast.File{
+		parse("func f() {}\nfunc g() {}\nfunc (T) f() {}"),
+		parse("func f() {}\nfunc g() {}\nfunc (*T) f() {}"),
+		parse("func f() {}\nfunc g() {}"),
+	}
+
+	dedupeObjects(buildable, nonBuildable)
+
+	var got [][]string
+	for _, f := range nonBuildable {
+		var names []string
+		for _, d := range f.Decls {
+			names = append(names, d.(*ast.FuncDecl).Name.Name)
+		}
+		got = append(got, names)
+	}
+
+	expected := [][]string{
+		{"f_nobuild1", "g", "f"},
+		// f_nobuild2 is taken by a buildable file
+		{"f_nobuild3", "g_nobuild1", "f_nobuild1"},
+		{"f_nobuild4", "g_nobuild2"},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
@@ -18,37 +18,65 @@ import (
 //   LookupType("encoding/json.Marshaler") // named types are <import path>.<name>
 //   LookupType("*encoding/json.Encoder")  // prepend "*" to get pointer type
 //   LookupType("[5]int")                  // for builtin types, use arbitary expression
+//   LookupType("map[string]io.Reader")    // which can refer to named types
+//   LookupType("example.com/pkg.Map[string,*bytes.Buffer]") // instantiates generic type
+//   LookupType("example.com/pkg.Keys[string,int]")          // yields *types.Signature for generic func
 //
 // If an error occurs or the type cannot be found, LookupType() panics.
 func (p *Package) LookupType(typeSpec string) types.Type {
+	t, err := p.TryLookupType(typeSpec)
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// TryLookupType() is like LookupType(), but returns an error instead of
+// panicking.
+func (p *Package) TryLookupType(typeSpec string) (types.Type, error) {
 	if cached := p.typesCache[typeSpec]; cached != nil {
-		return cached
+		return cached, nil
 	}
 
 	t, err := p.lookupType(typeSpec)
 	if err != nil {
-		panic(fmt.Sprintf("error looking up type %s: %s", typeSpec, err))
+		return nil, fmt.Errorf("error looking up type %s: %s", typeSpec, err)
 	}
 	if t == nil {
-		panic(fmt.Sprintf("no such type %s", typeSpec))
+		return nil, fmt.Errorf("no such type %s", typeSpec)
 	}
 
 	p.typesCache[typeSpec] = t
 
-	return t
+	return t, nil
 }
 
 func (p *Package) lookupType(typeSpec string) (types.Type, error) {
-	finalSlash := strings.LastIndexByte(typeSpec, '/')
-	firstDotAfterLastSlash := strings.IndexByte(typeSpec[finalSlash+1:], '.')
+	// generic instantiation, e.g. "example.com/pkg.Map[string,int]"
+	trimmed := strings.TrimLeft(typeSpec, "*")
+	if name, args := splitTypeArgs(trimmed); args != nil && strings.Contains(name, ".") {
+		obj, err := p.lookupObject(name)
+		if obj == nil || err != nil {
+			return nil, err
+		}
 
-	if firstDotAfterLastSlash == -1 {
-		// assume unnamed type expression
-		tv, err := types.Eval(token.NewFileSet(), nil, 0, typeSpec)
+		t, err := p.instantiate(obj, args)
 		if err != nil {
-			return nil, fmt.Errorf("error evaluating type expression %q: %s", typeSpec, err)
+			return nil, err
+		}
+
+		for numPtrs := len(typeSpec) - len(trimmed); numPtrs > 0; numPtrs-- {
+			t = types.NewPointer(t)
 		}
-		return tv.Type, nil
+		return t, nil
+	}
+
+	finalSlash := strings.LastIndexByte(typeSpec, '/')
+	firstDotAfterLastSlash := strings.IndexByte(typeSpec[finalSlash+1:], '.')
+
+	if firstDotAfterLastSlash == -1 || strings.ContainsAny(trimmed, "[](){} \t<") {
+		// assume unnamed type expression, e.g. "[]example.com/pkg.T"
+		return p.lookupTypeExpr(typeSpec)
 	}
 
 	dotIdx := finalSlash + 1 + firstDotAfterLastSlash
@@ -61,7 +89,7 @@ func (p *Package) lookupType(typeSpec string) (types.Type, error) {
 		tPkg = p.TypesPkg
 	} else {
 		var err error
-		tPkg, err = imp.Import(importPath)
+		tPkg, err = p.loader.imp.Import(importPath)
 		if err != nil {
 			return nil, fmt.Errorf("error importing %s: %s", importPath, err)
 		}
@@ -84,6 +112,70 @@ func (p *Package) lookupType(typeSpec string) (types.Type, error) {
 	return t, nil
 }
 
+// lookupTypeExpr evaluates the unnamed type expression typeSpec. Qualified
+// names in typeSpec, which types.Eval() can't resolve, are looked up and
+// replaced by identifiers declared in a scratch package.
+func (p *Package) lookupTypeExpr(typeSpec string) (types.Type, error) {
+	scratch := types.NewPackage("stan/lookup", "lookup")
+
+	var expr strings.Builder
+	for i := 0; i < len(typeSpec); {
+		// don't mistake the dots of variadic parameters for a qualified name
+		if strings.HasPrefix(typeSpec[i:], "...") {
+			expr.WriteString("...")
+			i += len("...")
+			continue
+		}
+
+		end := nameEnd(typeSpec, i)
+		if end == i {
+			expr.WriteByte(typeSpec[i])
+			i++
+			continue
+		}
+		if !strings.Contains(typeSpec[i:end], ".") {
+			expr.WriteString(typeSpec[i:end])
+			i = end
+			continue
+		}
+
+		if end < len(typeSpec) && typeSpec[end] == '[' {
+			// type arguments
+			depth := 0
+			for ; end < len(typeSpec); end++ {
+				if typeSpec[end] == '[' {
+					depth++
+				} else if typeSpec[end] == ']' {
+					depth--
+					if depth == 0 {
+						end++
+						break
+					}
+				}
+			}
+		}
+
+		t, err := p.lookupType(typeSpec[i:end])
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, fmt.Errorf("no such type %s", typeSpec[i:end])
+		}
+
+		ident := fmt.Sprintf("_stan%d", scratch.Scope().Len())
+		scratch.Scope().Insert(types.NewTypeName(token.NoPos, scratch, ident, t))
+		expr.WriteString(ident)
+		i = end
+	}
+
+	tv, err := types.Eval(token.NewFileSet(), scratch, token.NoPos, expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating type expression %q: %s", typeSpec, err)
+	}
+	return tv.Type, nil
+}
+
 // Look up a types.Object based on name.
 //
 //   LookupObject("io.EOF")         // yields *types.Var
@@ -92,28 +184,51 @@ func (p *Package) lookupType(typeSpec string) (types.Type, error) {
 //   LookupObject("io.Reader.Read") // yields *types.Func
 //   LookupObject("io.pipe.data")   // yields *types.Var
 //
+//   // methods and fields of an instantiated generic type
+//   LookupObject("example.com/pkg.List[int].Push")
+//
+// Type arguments on a generic function are checked, but since go/types has
+// no objects for function instantiations the generic *types.Func is
+// returned. Use LookupType() to get the instantiated signature.
+//
 // If an error occurs or the object cannot be found, LookupObject() panics.
 func (p *Package) LookupObject(objSpec string) types.Object {
+	o, err := p.TryLookupObject(objSpec)
+	if err != nil {
+		panic(err.Error())
+	}
+	return o
+}
+
+// TryLookupObject() is like LookupObject(), but returns an error instead of
+// panicking.
+func (p *Package) TryLookupObject(objSpec string) (types.Object, error) {
 	if cached := p.objectsCache[objSpec]; cached != nil {
-		return cached
+		return cached, nil
 	}
 
 	o, err := p.lookupObject(objSpec)
 	if err != nil {
-		panic(fmt.Sprintf("error looking up object %s: %s", objSpec, err))
+		return nil, fmt.Errorf("error looking up object %s: %s", objSpec, err)
 	}
 	if o == nil {
-		panic(fmt.Sprintf("no such object %s", objSpec))
+		return nil, fmt.Errorf("no such object %s", objSpec)
 	}
 
 	p.objectsCache[objSpec] = o
 
-	return o
+	return o, nil
 }
 
 func (p *Package) lookupObject(objSpec string) (types.Object, error) {
-	finalSlash := strings.LastIndexByte(objSpec, '/')
-	firstDotAfterLastSlash := strings.IndexByte(objSpec[finalSlash+1:], '.')
+	// type arguments can have slashes and dots of their own
+	head := objSpec
+	if i := strings.IndexByte(head, '['); i >= 0 {
+		head = head[:i]
+	}
+
+	finalSlash := strings.LastIndexByte(head, '/')
+	firstDotAfterLastSlash := strings.IndexByte(head[finalSlash+1:], '.')
 
 	if firstDotAfterLastSlash == -1 {
 		return nil, fmt.Errorf("invalid object specifier: %s", objSpec)
@@ -122,20 +237,22 @@ func (p *Package) lookupObject(objSpec string) (types.Object, error) {
 	dotIdx := finalSlash + 1 + firstDotAfterLastSlash
 
 	importPath := objSpec[:dotIdx]
-	parts := strings.Split(objSpec[dotIdx+1:], ".")
+	parts := splitTopLevel(objSpec[dotIdx+1:], '.')
+
+	name, typeArgs := splitTypeArgs(parts[0])
 
 	var tPkg *types.Package
 	if importPath == p.Path() {
 		tPkg = p.TypesPkg
 	} else {
 		var err error
-		tPkg, err = imp.Import(importPath)
+		tPkg, err = p.loader.imp.Import(importPath)
 		if err != nil {
 			return nil, fmt.Errorf("error importing %s: %s", importPath, err)
 		}
 	}
 
-	obj := tPkg.Scope().Lookup(parts[0])
+	obj := tPkg.Scope().Lookup(name)
 	if obj == nil {
 		for _, imp := range p.TypesInfo.Implicits {
 			pi, _ := imp.(*types.PkgName)
@@ -143,7 +260,7 @@ func (p *Package) lookupObject(objSpec string) (types.Object, error) {
 				continue
 			}
 
-			if pi.Name() == parts[0] {
+			if pi.Name() == name {
 				obj = imp
 				break
 			}
@@ -154,14 +271,23 @@ func (p *Package) lookupObject(objSpec string) (types.Object, error) {
 		return nil, nil
 	}
 
+	typ := obj.Type()
+	if typeArgs != nil {
+		var err error
+		if typ, err = p.instantiate(obj, typeArgs); err != nil {
+			return nil, err
+		}
+	}
+
 	for i := 1; i < len(parts); i++ {
-		nextObj, _, _ := types.LookupFieldOrMethod(obj.Type(), true, tPkg, parts[i])
+		nextObj, _, _ := types.LookupFieldOrMethod(typ, true, tPkg, parts[i])
 
 		if nextObj == nil {
 			return nil, fmt.Errorf("could not find %q on %s", parts[i], obj)
 		}
 
 		obj = nextObj
+		typ = obj.Type()
 	}
 
 	return obj, nil
@@ -175,7 +301,7 @@ func (p *Package) DeclOf(o types.Object) (otherPkg *Package, node ast.Node, ancs
 	if o.Pkg().Path() == p.Path() {
 		otherPkg = p
 	} else {
-		otherPkg = Pkgs(o.Pkg().Path())[0]
+		otherPkg = p.loader.Pkgs(o.Pkg().Path())[0]
 	}
 
 	sourceTokenFile := otherPkg.Fset.File(o.Pos())
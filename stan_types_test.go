@@ -73,3 +73,23 @@ func TestSpecialPackage(t *testing.T) {
 		t.Errorf("got %v", singleFoo)
 	}
 }
+
+func TestLookupTypeExpr(t *testing.T) {
+	foo := Pkgs("github.com/retailnext/stan/internal/foo")[0]
+	for _, spec := range []string{
+		"map[string]io.Reader",
+		"[]*github.com/retailnext/stan/internal/bar.BarType",
+		"func(...io.Reader) (int, error)",
+		"chan<- [2]io.Writer",
+	} {
+		if typ, err := foo.TryLookupType(spec); err != nil {
+			t.Errorf("%s: %s", spec, err)
+		} else if typ.String() != spec {
+			t.Errorf("%s: got %s", spec, typ)
+		}
+	}
+
+	if _, err := foo.TryLookupType("[]io.NoSuchType"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,3 @@
+package ok
+
+var Fine = 1
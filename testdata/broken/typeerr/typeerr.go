@@ -0,0 +1,3 @@
+package typeerr
+
+var NotFine int = "string"
@@ -0,0 +1,7 @@
+module example.com/mod
+
+go 1.12
+
+require example.com/dep v0.0.0
+
+replace example.com/dep => ../dep
@@ -0,0 +1,5 @@
+package mod
+
+import "example.com/dep"
+
+var ModVar dep.DepType
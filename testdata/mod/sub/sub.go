@@ -0,0 +1,5 @@
+package sub
+
+import "example.com/mod"
+
+var SubVar = mod.ModVar
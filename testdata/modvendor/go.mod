@@ -0,0 +1,5 @@
+module example.com/modvendor
+
+go 1.14
+
+require example.com/vendored v1.0.0
@@ -0,0 +1,5 @@
+package modvendor
+
+import "example.com/vendored"
+
+var VendorVar vendored.VendoredType